@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+)
+
+// Record is a single catalog mutation
+type Record struct {
+	Time      time.Time `json:"time"`
+	SyncID    string    `json:"sync_id"`
+	Trigger   string    `json:"trigger"`
+	Target    string    `json:"target"`
+	Operation string    `json:"operation"`
+	ServiceID string    `json:"service_id,omitempty"`
+	CheckID   string    `json:"check_id,omitempty"`
+	Node      string    `json:"node,omitempty"`
+
+	// Changed is the first field that differed from the remote catalog, empty for new services and deletes
+	Changed string          `json:"changed,omitempty"`
+	Before  *config.Service `json:"before,omitempty"`
+	After   *config.Service `json:"after,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(record *Record) error
+}
@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File appends audit records as JSON lines to a file
+type File struct {
+	file *os.File
+	sync.Mutex
+}
+
+// NewFile opens the file for appending, creating it if needed
+func NewFile(path string) (*File, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log %s: %s", path, err)
+	}
+
+	return &File{file: file}, nil
+}
+
+// Write ...
+func (f *File) Write(record *Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	_, err = f.file.Write(append(line, '\n'))
+	return err
+}
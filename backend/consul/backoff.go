@@ -0,0 +1,34 @@
+package consul
+
+import (
+	"math/rand"
+	"time"
+)
+
+// minQueryInterval is the minimum time between two blocking queries
+const minQueryInterval = time.Second
+
+// backoff is an exponential backoff with jitter for retrying failed reads,
+// so readers in many datacenters do not retry in lockstep
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+// next returns how long to wait before the next attempt, between half and the full exponential delay
+func (b *backoff) next() time.Duration {
+	delay := b.max
+	if b.attempt < 32 && b.min<<b.attempt < b.max {
+		delay = b.min << b.attempt
+	}
+	b.attempt++
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// reset starts over after a successful attempt
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,30 @@
+package consul
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := &backoff{min: time.Second, max: 10 * time.Second}
+
+	// the delay doubles from min and is capped at max, the wait is between half and the full delay
+	for i, delay := range []time.Duration{1, 2, 4, 8, 10, 10, 10} {
+		delay *= time.Second
+
+		if wait := b.next(); wait < delay/2 || wait > delay {
+			t.Errorf("attempt %d: got %s, want between %s and %s", i, wait, delay/2, delay)
+		}
+	}
+
+	// a long run of failures does not overflow the shift
+	b.attempt = 100
+	if wait := b.next(); wait < 5*time.Second || wait > 10*time.Second {
+		t.Errorf("got %s after 100 attempts", wait)
+	}
+
+	b.reset()
+	if wait := b.next(); wait < 500*time.Millisecond || wait > time.Second {
+		t.Errorf("got %s after a reset, want between 500ms and 1s", wait)
+	}
+}
@@ -5,22 +5,107 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Config ...
+type Config struct {
+	InstanceID string
+	MultiNode  bool
+	Datacenter string
+	Namespace  string
+	Partition  string
+	TokenFile  string
+
+	// Stale lets any server answer reads, not only the leader
+	Stale bool
+}
+
 // Backend ...
 type Backend struct {
 	client *api.Client
+	config Config
+	token  *tokenFile
+
+	// changed is set by the operations of a pass, Flush then asks the reader for a fresh read on refresh
+	changed bool
+	refresh chan struct{}
 }
 
 // NewBackend ...
-func NewBackend() *Backend {
+func NewBackend(config Config) *Backend {
 	client, err := api.NewClient(api.DefaultConfig())
 	if err != nil {
 		log.Fatalf("Can not create Consul client: %s", err)
 	}
 
+	b := &Backend{
+		client:  client,
+		config:  config,
+		refresh: make(chan struct{}, 1),
+	}
+
+	if config.TokenFile != "" {
+		b.token = newTokenFile(config.TokenFile)
+		if _, err := b.token.get(); err != nil {
+			log.Fatalf("Could not read Consul token file: %s", err)
+		}
+	}
+
 	_, err = client.Status().Leader()
 	if err != nil {
 		log.Fatalf("Could not connect to Consul client: %s", err)
 	}
 
-	return &Backend{client}
+	return b
+}
+
+// Flush asks the reader for a fresh read once a pass changed the catalog. The blocking query
+// follows the index of the services (or of the checks with multiple nodes), a change to the other
+// alone, such as a deleted orphan check, would otherwise stay unseen and be planned again
+func (b *Backend) Flush() error {
+	if !b.changed {
+		return nil
+	}
+	b.changed = false
+
+	select {
+	case b.refresh <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// queryOptions returns the QueryOptions all reads should start from
+func (b *Backend) queryOptions() *api.QueryOptions {
+	return &api.QueryOptions{
+		Datacenter: b.config.Datacenter,
+		Namespace:  b.config.Namespace,
+		Partition:  b.config.Partition,
+		Token:      b.currentToken(),
+		AllowStale: b.config.Stale,
+	}
+}
+
+// writeOptions returns the WriteOptions all writes should use
+func (b *Backend) writeOptions() *api.WriteOptions {
+	return &api.WriteOptions{
+		Datacenter: b.config.Datacenter,
+		Namespace:  b.config.Namespace,
+		Partition:  b.config.Partition,
+		Token:      b.currentToken(),
+	}
+}
+
+// currentToken returns the token from the token file, or an empty string
+// to let the Consul client fall back to its own configuration
+func (b *Backend) currentToken() string {
+	if b.token == nil {
+		return ""
+	}
+
+	token, err := b.token.get()
+	if err != nil {
+		log.Errorf("Could not re-read Consul token file, using previous token: %s", err)
+	}
+
+	return token
 }
@@ -1,30 +1,65 @@
 package consul
 
 import (
+	"fmt"
+
 	api "github.com/hashicorp/consul/api"
-	log "github.com/sirupsen/logrus"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
 )
 
 // DeleteService ...
-func (b *Backend) DeleteService(service, node string) {
+func (b *Backend) DeleteService(service, node string) error {
 	_, err := b.client.Catalog().Deregister(&api.CatalogDeregistration{
 		Node:      node,
 		ServiceID: service,
-	}, &api.WriteOptions{})
+	}, b.writeOptions())
 
 	if err != nil {
-		log.Errorf("Could not delete consul service %s for node %s: %s", service, node, err)
+		return fmt.Errorf("could not delete consul service %s for node %s: %s", service, node, err)
+	}
+	b.changed = true
+
+	if b.config.MultiNode {
+		return b.deleteNodeIfEmpty(node)
 	}
+
+	return nil
+}
+
+// deleteNodeIfEmpty deregisters one of our nodes once its last service is gone
+func (b *Backend) deleteNodeIfEmpty(node string) error {
+	catalogNode, _, err := b.client.Catalog().Node(node, b.queryOptions())
+	if err != nil {
+		return fmt.Errorf("could not read consul node %s: %s", node, err)
+	}
+
+	if catalogNode == nil || catalogNode.Node == nil || len(catalogNode.Services) > 0 {
+		return nil
+	}
+
+	if _, ok := catalogNode.Node.Meta[config.NodeMetaGroup]; !ok {
+		return nil
+	}
+
+	_, err = b.client.Catalog().Deregister(&api.CatalogDeregistration{Node: node}, b.writeOptions())
+	if err != nil {
+		return fmt.Errorf("could not delete consul node %s: %s", node, err)
+	}
+
+	return nil
 }
 
 // DeleteCheck ...
-func (b *Backend) DeleteCheck(check, node string) {
+func (b *Backend) DeleteCheck(check, node string) error {
 	_, err := b.client.Catalog().Deregister(&api.CatalogDeregistration{
 		Node:    node,
 		CheckID: check,
-	}, &api.WriteOptions{})
+	}, b.writeOptions())
 
 	if err != nil {
-		log.Errorf("Could not delete consul check %s for node %s: %s", check, node, err)
+		return fmt.Errorf("could not delete consul check %s for node %s: %s", check, node, err)
 	}
+	b.changed = true
+
+	return nil
 }
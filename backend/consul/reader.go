@@ -1,6 +1,7 @@
 package consul
 
 import (
+	"context"
 	"time"
 
 	consul "github.com/hashicorp/consul/api"
@@ -8,13 +9,12 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// internalNode ...
-type internalNode struct {
-	Node            string
-	Address         string
-	TaggedAddresses map[string]string
-	Services        []*consul.AgentService
-	Checks          []*consul.AgentCheck
+// node is a catalog node with its services and checks
+type node struct {
+	Node     string
+	Address  string
+	Services []*consul.AgentService
+	Checks   consul.HealthChecks
 }
 
 // CatalogReader ...
@@ -22,13 +22,16 @@ func (b *Backend) CatalogReader(state *config.CatalogState, consulNodeName strin
 	logger := log.WithField("worker", "consul-reader")
 	logger.Info("Starting Consul catalog reader")
 
-	raw := b.client.Raw()
+	q := b.queryOptions()
+	q.WaitTime = 120 * time.Second
 
-	q := &consul.QueryOptions{
-		WaitIndex: 1,
-		WaitTime:  120 * time.Second,
+	if b.config.MultiNode {
+		q.NodeMeta = map[string]string{config.NodeMetaGroup: consulNodeName}
 	}
 
+	retry := &backoff{min: time.Second, max: time.Minute}
+	loaded := false
+
 	for {
 		select {
 		case <-quitCh:
@@ -36,63 +39,232 @@ func (b *Backend) CatalogReader(state *config.CatalogState, consulNodeName strin
 
 		default:
 			logger.Debug("Waiting for Node information to change")
+			q.Token = b.currentToken()
+			start := time.Now()
 
-			var newNode internalNode
-
-			meta, err := raw.Query("/v1/internal/ui/node/"+consulNodeName, &newNode, q)
+			nodes, meta, interrupted, err := b.query(q, consulNodeName, quitCh)
+			if interrupted {
+				logger.Debug("Reading the catalog again after a pass changed it")
+				q.WaitIndex = 0
+				continue
+			}
 			if err != nil {
-				logger.Errorf("unable to fetch Consul node information: %s", err)
-				time.Sleep(10 * time.Second)
+				wait := retry.next()
+				logger.Errorf("unable to fetch Consul node information, retrying in %s: %s", wait, err)
+
+				select {
+				case <-quitCh:
+					return
+				case <-time.After(wait):
+				}
+
 				continue
 			}
+			retry.reset()
+
+			// a blocking query returning right away over and over would otherwise spin
+			if elapsed := time.Since(start); elapsed < minQueryInterval {
+				select {
+				case <-quitCh:
+					return
+				case <-time.After(minQueryInterval - elapsed):
+				}
+			}
 
 			remoteWaitIndex := meta.LastIndex
 			localWaitIndex := q.WaitIndex
+			q.WaitIndex = nextIndex(localWaitIndex, remoteWaitIndex, logger)
 
-			if remoteWaitIndex == localWaitIndex {
+			if loaded && remoteWaitIndex == localWaitIndex {
 				logger.Debugf("Wait index is unchanged (%d == %d)", localWaitIndex, remoteWaitIndex)
 				continue
 			}
 
 			logger.Debugf("Wait index is changed (%d <> %d)", localWaitIndex, remoteWaitIndex)
-			q.WaitIndex = remoteWaitIndex
+
+			services := make(config.Services)
+			checks := make(config.Checks, 0)
+			for _, n := range nodes {
+				nodeServices, nodeChecks := b.processCatalog(n, logger)
+				for id, service := range nodeServices {
+					services[id] = service
+				}
+				checks = append(checks, nodeChecks...)
+			}
 
 			state.Lock()
-			state.Services = processCatalog(newNode)
+			state.Services = services
+			state.Checks = checks
 			state.Unlock()
+			state.MarkReady()
+			loaded = true
+		}
+	}
+}
+
+// query runs the blocking query of the catalog. It is interrupted, and returns true, when a pass
+// asks for a refresh or on quit
+func (b *Backend) query(q *consul.QueryOptions, consulNodeName string, quitCh chan int) ([]*node, *consul.QueryMeta, bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+
+	go func() {
+		select {
+		case <-b.refresh:
+		case <-quitCh:
+		case <-done:
+			interrupted <- false
+			return
+		}
+
+		interrupted <- true
+		cancel()
+	}()
+
+	var nodes []*node
+	var meta *consul.QueryMeta
+	var err error
+
+	if b.config.MultiNode {
+		nodes, meta, err = b.readNodes(q.WithContext(ctx), consulNodeName)
+	} else {
+		nodes, meta, err = b.readNode(consulNodeName, q.WithContext(ctx))
+	}
+	close(done)
+
+	if <-interrupted {
+		return nil, nil, true, nil
+	}
+
+	return nodes, meta, false, err
+}
+
+// nextIndex returns the index to block on next, following the Consul blocking query guidance
+func nextIndex(current, last uint64, logger *log.Entry) uint64 {
+	switch {
+	// blocking on 0 returns right away, which would turn the reader into a busy loop
+	case last == 0:
+		return 1
+
+	// the index went backwards, e.g. after a snapshot restore or on a stale server, start over
+	case last < current:
+		logger.Warnf("Wait index went backwards (%d < %d), resetting it", last, current)
+		return 0
+
+	default:
+		return last
+	}
+}
+
+// readNode waits for changes to the services of a single node
+func (b *Backend) readNode(name string, q *consul.QueryOptions) ([]*node, *consul.QueryMeta, error) {
+	list, meta, err := b.client.Catalog().NodeServiceList(name, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the node does not exist (yet)
+	if list == nil || list.Node == nil {
+		return []*node{}, meta, nil
+	}
+
+	checks, _, err := b.client.Health().Node(name, b.queryOptions())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []*node{{Node: name, Address: list.Node.Address, Services: list.Services, Checks: checks}}, meta, nil
+}
+
+// readNodes waits for changes to the checks on any node matching the node meta of the query,
+// every service we register has a check, then reads every node that has checks. The legacy
+// single node is read as well, so services registered there before switching to multiple
+// nodes are moved instead of being left behind
+func (b *Backend) readNodes(q *consul.QueryOptions, legacyNode string) ([]*node, *consul.QueryMeta, error) {
+	checks, meta, err := b.client.Health().State(consul.HealthAny, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := map[string]bool{legacyNode: true}
+	for _, check := range checks {
+		names[check.Node] = true
+	}
+
+	nodes := make([]*node, 0, len(names))
+	for name := range names {
+		n, _, err := b.readNode(name, b.queryOptions())
+		if err != nil {
+			return nil, nil, err
 		}
+
+		nodes = append(nodes, n...)
 	}
+
+	return nodes, meta, nil
 }
 
-func processCatalog(n internalNode) config.Services {
+// processCatalog returns the services on the node that carry our ownership markers with their checks,
+// and the checks that do not belong to any of them. Services registered by hand or by another tool
+// are left alone
+func (b *Backend) processCatalog(n *node, logger *log.Entry) (config.Services, config.Checks) {
 	services := make(config.Services)
 
 	for _, service := range n.Services {
 		services[service.ID] = &config.Service{
+			CheckNode:      n.Node,
+			NodeAddress:    n.Address,
 			ServiceID:      service.ID,
 			ServiceName:    service.Service,
 			ServiceTags:    service.Tags,
 			ServiceAddress: service.Address,
 			ServicePort:    service.Port,
 			ServiceMeta:    service.Meta,
+			Checks:         make(config.Checks, 0),
 		}
 	}
 
+	checks := make(config.Checks, 0)
+
 	for _, check := range n.Checks {
 		if check.CheckID == "serfHealth" {
 			continue
 		}
 
-		if _, ok := services[check.ServiceID]; !ok {
-			log.Errorf("Could not find a service '%s' for check '%s'", check.ServiceID, check.CheckID)
+		c := &config.Check{
+			CheckID:   check.CheckID,
+			Node:      check.Node,
+			ServiceID: check.ServiceID,
+			Name:      check.Name,
+			Status:    check.Status,
+			Output:    check.Output,
+			Notes:     check.Notes,
 		}
 
-		services[check.ServiceID].CheckID = check.CheckID
-		services[check.ServiceID].CheckNode = check.Node
-		services[check.ServiceID].CheckStatus = check.Status
-		services[check.ServiceID].CheckOutput = check.Output
-		services[check.ServiceID].CheckNotes = check.Notes
+		service, ok := services[check.ServiceID]
+		if !ok {
+			if check.ServiceID != "" {
+				logger.Warnf("Could not find a service '%s' for check '%s' on node %s", check.ServiceID, check.CheckID, n.Node)
+			}
+
+			checks = append(checks, c)
+			continue
+		}
+
+		service.Checks = append(service.Checks, c)
+
+		// the check we write for the service, other checks attached to it are kept as they are
+		if check.CheckID == config.CheckIDPrefix+service.ServiceID {
+			service.CheckID = check.CheckID
+			service.CheckNode = check.Node
+			service.CheckStatus = check.Status
+			service.CheckOutput = check.Output
+			service.CheckNotes = check.Notes
+		}
 	}
 
-	return services
+	return services, checks
 }
@@ -0,0 +1,227 @@
+package consul
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config/configtest"
+	log "github.com/sirupsen/logrus"
+)
+
+func ownedService(id string) *consul.AgentService {
+	return &consul.AgentService{
+		ID:      id,
+		Service: id,
+		Address: id + ".rds.amazonaws.com",
+		Port:    5432,
+		Meta:    map[string]string{config.MetaManagedBy: config.ManagedBy, config.MetaManagedByInstance: "rds"},
+	}
+}
+
+func healthCheck(id, serviceID string) *consul.HealthCheck {
+	return &consul.HealthCheck{Node: "rds", CheckID: id, ServiceID: serviceID, Status: "passing"}
+}
+
+func TestProcessCatalog(t *testing.T) {
+	foreign := ownedService("payments")
+	foreign.Meta = map[string]string{"owner": "someone else"}
+
+	tests := []struct {
+		name     string
+		services []*consul.AgentService
+		checks   consul.HealthChecks
+		// want maps the service IDs to the IDs of their checks
+		want    map[string][]string
+		orphans []string
+	}{
+		{
+			name:     "check of a missing service",
+			services: []*consul.AgentService{ownedService("orders")},
+			checks:   consul.HealthChecks{healthCheck("service:orders", "orders"), healthCheck("service:gone", "gone")},
+			want:     map[string][]string{"orders": {"service:orders"}},
+			orphans:  []string{"service:gone"},
+		},
+		{
+			name:     "node-level check",
+			services: []*consul.AgentService{ownedService("orders")},
+			checks:   consul.HealthChecks{healthCheck("serfHealth", ""), healthCheck("maintenance", ""), healthCheck("service:orders", "orders")},
+			want:     map[string][]string{"orders": {"service:orders"}},
+			orphans:  []string{"maintenance"},
+		},
+		{
+			// foreign services are returned with their checks, the writer leaves them alone
+			name:     "check of a foreign service",
+			services: []*consul.AgentService{ownedService("orders"), foreign},
+			checks:   consul.HealthChecks{healthCheck("service:orders", "orders"), healthCheck("service:payments", "payments")},
+			want:     map[string][]string{"orders": {"service:orders"}, "payments": {"service:payments"}},
+			orphans:  []string{},
+		},
+		{
+			name:     "second check of one of our services",
+			services: []*consul.AgentService{ownedService("orders")},
+			checks:   consul.HealthChecks{healthCheck("orders-tcp", "orders"), healthCheck("service:orders", "orders")},
+			want:     map[string][]string{"orders": {"orders-tcp", "service:orders"}},
+			orphans:  []string{},
+		},
+	}
+
+	quiet := log.New()
+	quiet.Out = io.Discard
+	b := &Backend{config: Config{InstanceID: "rds"}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			services, orphans := b.processCatalog(&node{Node: "rds", Services: test.services, Checks: test.checks}, log.NewEntry(quiet))
+
+			got := make(map[string][]string)
+			for id, service := range services {
+				got[id] = make([]string, 0)
+				for _, check := range service.Checks {
+					got[id] = append(got[id], check.CheckID)
+				}
+				sort.Strings(got[id])
+
+				if service.CheckID != "service:"+id {
+					t.Errorf("service %s has check ID %q", id, service.CheckID)
+				}
+			}
+			configtest.Equal(t, got, test.want)
+
+			orphanIDs := make([]string, 0)
+			for _, check := range orphans {
+				orphanIDs = append(orphanIDs, check.CheckID)
+			}
+			configtest.Equal(t, orphanIDs, test.orphans)
+		})
+	}
+}
+
+func TestNextIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		current uint64
+		last    uint64
+		want    uint64
+	}{
+		{name: "first read", current: 0, last: 0, want: 1},
+		{name: "index reset to 0", current: 42, last: 0, want: 1},
+		{name: "index went backwards", current: 42, last: 7, want: 0},
+		{name: "index moved forward", current: 42, last: 43, want: 43},
+		{name: "index unchanged", current: 42, last: 42, want: 42},
+	}
+
+	quiet := log.New()
+	quiet.Out = io.Discard
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := nextIndex(test.current, test.last, log.NewEntry(quiet)); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// fakeCatalog is a single Consul node whose service list is only changed by tests, so its blocking
+// queries never return on a change to checks alone, like Consul's index of the services
+type fakeCatalog struct {
+	sync.Mutex
+	services []*consul.AgentService
+	checks   consul.HealthChecks
+}
+
+func (f *fakeCatalog) serve(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/v1/catalog/node-services/rds":
+		// a blocking query on the current index waits until it times out or is cancelled
+		if req.URL.Query().Get("index") == "10" {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+
+		f.Lock()
+		defer f.Unlock()
+		w.Header().Set("X-Consul-Index", "10")
+		json.NewEncoder(w).Encode(&consul.CatalogNodeServiceList{Node: &consul.Node{Node: "rds"}, Services: f.services})
+
+	case "/v1/health/node/rds":
+		f.Lock()
+		defer f.Unlock()
+		w.Header().Set("X-Consul-Index", "10")
+		json.NewEncoder(w).Encode(f.checks)
+
+	case "/v1/catalog/deregister":
+		dereg := &consul.CatalogDeregistration{}
+		json.NewDecoder(req.Body).Decode(dereg)
+
+		f.Lock()
+		defer f.Unlock()
+		checks := make(consul.HealthChecks, 0)
+		for _, check := range f.checks {
+			if check.CheckID != dereg.CheckID {
+				checks = append(checks, check)
+			}
+		}
+		f.checks = checks
+		json.NewEncoder(w).Encode(true)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestReaderRefreshesAfterAPass(t *testing.T) {
+	f := &fakeCatalog{
+		services: []*consul.AgentService{ownedService("orders")},
+		checks:   consul.HealthChecks{healthCheck("service:orders", "orders"), healthCheck("service:gone", "gone")},
+	}
+	server := httptest.NewServer(http.HandlerFunc(f.serve))
+	defer server.Close()
+
+	client, err := consul.NewClient(&consul.Config{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Backend{client: client, config: Config{InstanceID: "rds"}, refresh: make(chan struct{}, 1)}
+	state := config.NewCatalogState()
+	quitCh := make(chan int)
+	defer close(quitCh)
+
+	go b.CatalogReader(state, "rds", quitCh)
+	<-state.Ready()
+
+	orphans := func() int {
+		state.Lock()
+		defer state.Unlock()
+		return len(state.Checks)
+	}
+	configtest.Equal(t, orphans(), 1)
+
+	// a pass deletes the orphaned check, which does not wake the blocking query on the services
+	if err := b.DeleteCheck("service:gone", "rds"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for orphans() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the reader kept the deleted check")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
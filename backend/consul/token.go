@@ -0,0 +1,53 @@
+package consul
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenFile keeps a Consul ACL token read from disk, re-reading it whenever
+// the file is modified so rotated tokens are picked up without a restart
+type tokenFile struct {
+	path    string
+	token   string
+	modTime time.Time
+	sync.Mutex
+}
+
+func newTokenFile(path string) *tokenFile {
+	return &tokenFile{path: path}
+}
+
+// get returns the current token. On error the last known token is returned
+// together with the error
+func (t *tokenFile) get() (string, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return t.token, err
+	}
+
+	if !info.ModTime().After(t.modTime) && t.token != "" {
+		return t.token, nil
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return t.token, err
+	}
+
+	if t.token != "" {
+		log.Infof("Consul token file %s changed, reloading token", t.path)
+	}
+
+	t.token = strings.TrimSpace(string(data))
+	t.modTime = info.ModTime()
+
+	return t.token, nil
+}
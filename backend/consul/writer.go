@@ -1,16 +1,24 @@
 package consul
 
 import (
+	"fmt"
+
 	api "github.com/hashicorp/consul/api"
 	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
-	log "github.com/sirupsen/logrus"
 )
 
 // WriteService ...
-func (b *Backend) WriteService(service *config.Service) {
+func (b *Backend) WriteService(service *config.Service) error {
+	// nodes shared by services with different addresses have an address of their own
+	address := service.NodeAddress
+	if address == "" {
+		address = service.ServiceAddress
+	}
+
 	save := &api.CatalogRegistration{
-		Node:    service.CheckNode,
-		Address: service.ServiceAddress,
+		Node:     service.CheckNode,
+		Address:  address,
+		NodeMeta: service.NodeMeta,
 		Service: &api.AgentService{
 			Address: service.ServiceAddress,
 			ID:      service.ServiceID,
@@ -31,9 +39,12 @@ func (b *Backend) WriteService(service *config.Service) {
 		},
 	}
 
-	_, err := b.client.Catalog().Register(save, &api.WriteOptions{})
+	_, err := b.client.Catalog().Register(save, b.writeOptions())
 
 	if err != nil {
-		log.Errorf("Could not write consul catalog: %s", err)
+		return fmt.Errorf("could not write consul catalog: %s", err)
 	}
+
+	b.changed = true
+	return nil
 }
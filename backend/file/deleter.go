@@ -0,0 +1,39 @@
+package file
+
+// DeleteService ...
+func (b *Backend) DeleteService(service, node string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.services[service]; !ok {
+		return nil
+	}
+
+	delete(b.services, service)
+	b.dirty = true
+
+	return nil
+}
+
+// DeleteCheck ...
+func (b *Backend) DeleteCheck(check, node string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, service := range b.services {
+		if service.CheckID != check {
+			continue
+		}
+
+		service.CheckID = ""
+		service.CheckNode = ""
+		service.CheckNotes = ""
+		service.CheckStatus = ""
+		service.CheckOutput = ""
+		b.dirty = true
+
+		return nil
+	}
+
+	return nil
+}
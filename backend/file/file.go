@@ -0,0 +1,212 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Stdout is the path that makes the backend print the catalog instead of writing a file
+const Stdout = "-"
+
+// Backend ...
+type Backend struct {
+	path         string
+	format       Format
+	pollInterval time.Duration
+	services     config.Services
+	changed      chan struct{}
+
+	// modTime is the modification time of the file when it was last read or written
+	modTime time.Time
+
+	// dirty is set by the operations of a pass, the catalog is only written by Flush
+	dirty bool
+	sync.Mutex
+}
+
+// NewBackend ...
+func NewBackend(path, format string, pollInterval time.Duration) *Backend {
+	f, err := NewFormat(format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return NewBackendWithFormat(path, f, pollInterval)
+}
+
+// NewBackendWithFormat ...
+func NewBackendWithFormat(path string, format Format, pollInterval time.Duration) *Backend {
+	b := &Backend{
+		path:         path,
+		format:       format,
+		pollInterval: pollInterval,
+		services:     make(config.Services),
+		changed:      make(chan struct{}, 1),
+	}
+
+	if err := b.load(); err != nil {
+		log.Fatalf("Could not read catalog file %s: %s", path, err)
+	}
+
+	return b
+}
+
+// load reads the existing catalog file, if any
+func (b *Backend) load() error {
+	if b.path == Stdout {
+		return nil
+	}
+
+	info, err := os.Stat(b.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return err
+	}
+
+	services, err := b.format.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	b.services = services
+	b.modTime = info.ModTime()
+	return nil
+}
+
+// reload reads the catalog file again if it was modified or removed since it was last read or
+// written, so edits made by hand or by another tool are seen and reverted by the next pass.
+// Returns true if the catalog changed. A pass in progress is never overwritten
+func (b *Backend) reload() (bool, error) {
+	if b.path == Stdout {
+		return false, nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.dirty {
+		return false, nil
+	}
+
+	info, err := os.Stat(b.path)
+	if os.IsNotExist(err) {
+		if b.modTime.IsZero() {
+			return false, nil
+		}
+
+		b.services = make(config.Services)
+		b.modTime = time.Time{}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if info.ModTime().Equal(b.modTime) {
+		return false, nil
+	}
+
+	if err := b.load(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Flush writes the catalog once per pass if any operation changed it, so readers never see a
+// half-applied pass and stdout gets a single document per pass
+func (b *Backend) Flush() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.dirty {
+		return nil
+	}
+
+	if err := b.flush(); err != nil {
+		return err
+	}
+
+	b.dirty = false
+	return nil
+}
+
+// flush writes the catalog through a temporary file renamed over the target,
+// so readers never see a partially written file. Must be called with the lock held
+func (b *Backend) flush() error {
+	data, err := b.format.Encode(b.services)
+	if err != nil {
+		return fmt.Errorf("could not encode catalog: %s", err)
+	}
+
+	select {
+	case b.changed <- struct{}{}:
+	default:
+	}
+
+	if b.path == Stdout {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), "."+filepath.Base(b.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("could not create temporary catalog file: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write temporary catalog file: %s", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not sync temporary catalog file: %s", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not close temporary catalog file: %s", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("could not change catalog file mode: %s", err)
+	}
+
+	if err := os.Rename(tmp.Name(), b.path); err != nil {
+		return fmt.Errorf("could not move catalog file into place: %s", err)
+	}
+
+	if info, err := os.Stat(b.path); err == nil {
+		b.modTime = info.ModTime()
+	}
+
+	return nil
+}
+
+// snapshot returns a copy of the catalog safe to hand to the writer
+func (b *Backend) snapshot() config.Services {
+	b.Lock()
+	defer b.Unlock()
+
+	services := make(config.Services, len(b.services))
+	for id, service := range b.services {
+		s := *service
+		services[id] = &s
+	}
+
+	return services
+}
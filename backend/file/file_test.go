@@ -0,0 +1,94 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config/configtest"
+)
+
+func TestReaderReloadsModifiedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	b := NewBackend(path, "json", 20*time.Millisecond)
+
+	if err := b.WriteService(configtest.Service("orders", "orders", "orders.rds.amazonaws.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	state := config.NewCatalogState()
+	quitCh := make(chan int)
+	defer close(quitCh)
+
+	go b.CatalogReader(state, "rds", quitCh)
+	<-state.Ready()
+
+	services := func() []string {
+		state.Lock()
+		defer state.Unlock()
+		return state.Services.IDs()
+	}
+	configtest.Equal(t, services(), []string{"orders"})
+
+	// an edit by hand replaces the service, a later modification time makes sure it is seen
+	edited := `{"billing": {"ServiceID": "billing", "ServiceName": "billing"}}`
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return len(services()) == 1 && services()[0] == "billing" })
+
+	// a removed file is an empty catalog, so the next pass writes it again
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return len(services()) == 0 })
+}
+
+func TestReloadKeepsPassInProgress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBackend(path, "json", 0)
+	if err := b.WriteService(configtest.Service("orders", "orders", "orders.rds.amazonaws.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := b.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded {
+		t.Error("reloaded the file during a pass")
+	}
+	configtest.Equal(t, b.snapshot().IDs(), []string{"orders"})
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
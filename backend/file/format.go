@@ -0,0 +1,62 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"sigs.k8s.io/yaml"
+)
+
+// Format encodes the catalog to, and decodes it from, the file contents
+type Format interface {
+	Encode(services config.Services) ([]byte, error)
+	Decode(data []byte) (config.Services, error)
+}
+
+// NewFormat returns the Format with the given name
+func NewFormat(name string) (Format, error) {
+	switch name {
+	case "json":
+		return jsonFormat{}, nil
+	case "yaml":
+		return yamlFormat{}, nil
+	default:
+		return nil, fmt.Errorf("file format value %s is not a valid option (json or yaml)", name)
+	}
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Encode(services config.Services) ([]byte, error) {
+	data, err := json.MarshalIndent(services, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+func (jsonFormat) Decode(data []byte) (config.Services, error) {
+	services := make(config.Services)
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, err
+	}
+
+	return services, nil
+}
+
+type yamlFormat struct{}
+
+func (yamlFormat) Encode(services config.Services) ([]byte, error) {
+	return yaml.Marshal(services)
+}
+
+func (yamlFormat) Decode(data []byte) (config.Services, error) {
+	services := make(config.Services)
+	if err := yaml.Unmarshal(data, &services); err != nil {
+		return nil, err
+	}
+
+	return services, nil
+}
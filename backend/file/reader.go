@@ -0,0 +1,48 @@
+package file
+
+import (
+	"time"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// CatalogReader ...
+func (b *Backend) CatalogReader(state *config.CatalogState, nodeName string, quitCh chan int) {
+	logger := log.WithField("worker", "file-reader")
+	logger.Info("Starting file catalog reader")
+
+	// the file is checked for outside changes on every poll, a zero interval disables it
+	var poll <-chan time.Time
+	if b.pollInterval > 0 && b.path != Stdout {
+		ticker := time.NewTicker(b.pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		services := b.snapshot()
+
+		state.Lock()
+		state.Services = services
+		state.Unlock()
+		state.MarkReady()
+
+		select {
+		case <-quitCh:
+			return
+
+		case <-b.changed:
+			logger.Debug("Catalog file changed")
+
+		case <-poll:
+			reloaded, err := b.reload()
+			if err != nil {
+				logger.Errorf("Could not read catalog file %s: %s", b.path, err)
+			}
+			if reloaded {
+				logger.Infof("Catalog file %s was modified outside of a pass, reloaded it", b.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package file
+
+import (
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+)
+
+// WriteService ...
+func (b *Backend) WriteService(service *config.Service) error {
+	b.Lock()
+	defer b.Unlock()
+
+	s := *service
+	b.services[service.ServiceID] = &s
+	b.dirty = true
+
+	return nil
+}
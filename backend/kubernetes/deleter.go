@@ -0,0 +1,49 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeleteService deletes the Kubernetes Service, its EndpointSlice is garbage
+// collected through its owner reference
+func (b *Backend) DeleteService(service, node string) error {
+	services := b.client.CoreV1().Services(b.config.Namespace)
+	name := objectName(service)
+
+	existing, err := services.Get(context.Background(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read Kubernetes service %s: %s", name, err)
+	}
+
+	if !b.isOwned(existing.Labels) {
+		return fmt.Errorf("service %s/%s is not managed by %s, not deleting it", existing.Namespace, existing.Name, b.config.OwnerID)
+	}
+
+	// another service ID with the same object name, ours was never written
+	if id := serviceID(existing); id != "" && id != service {
+		return nil
+	}
+
+	err = services.Delete(context.Background(), name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &existing.UID},
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("could not delete Kubernetes service %s: %s", name, err)
+	}
+
+	b.notify()
+
+	return nil
+}
+
+// DeleteCheck is a no-op, checks only live on the service objects
+func (b *Backend) DeleteCheck(check, node string) error {
+	return nil
+}
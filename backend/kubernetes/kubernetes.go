@@ -0,0 +1,176 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// ModeExternalName writes a Service of type ExternalName per service
+	ModeExternalName = "externalname"
+
+	// ModeEndpointSlice writes a headless Service with an IPv4 EndpointSlice per service, holding the
+	// addresses the RDS endpoint resolves to. FQDN endpoint slices are deprecated and not resolved by
+	// kube-proxy or CoreDNS
+	ModeEndpointSlice = "endpointslice"
+
+	managedBy        = "aws-dynamic-consul-catalog"
+	labelManagedBy   = "app.kubernetes.io/managed-by"
+	labelOwner       = "aws-dynamic-consul-catalog/owner"
+	labelServiceName = "aws-dynamic-consul-catalog/service-name"
+	annotationSource = "aws-dynamic-consul-catalog/service"
+)
+
+var invalidNameCharsRegexp = regexp.MustCompile("[^a-z0-9-]+")
+
+// Config ...
+type Config struct {
+	Kubeconfig   string
+	Namespace    string
+	Mode         string
+	OwnerID      string
+	PollInterval time.Duration
+}
+
+// Backend ...
+type Backend struct {
+	client  kubernetes.Interface
+	config  Config
+	changed chan struct{}
+
+	// resolve returns the sorted IPv4 addresses of a host name
+	resolve func(host string) ([]string, error)
+}
+
+// NewBackend ...
+func NewBackend(cfg Config) *Backend {
+	var restConfig *rest.Config
+	var err error
+
+	if cfg.Kubeconfig != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", cfg.Kubeconfig)
+	} else {
+		restConfig, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		log.Fatalf("Can not create Kubernetes client configuration: %s", err)
+	}
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		log.Fatalf("Can not create Kubernetes client: %s", err)
+	}
+
+	return NewBackendWithClient(client, cfg)
+}
+
+// NewBackendWithClient ...
+func NewBackendWithClient(client kubernetes.Interface, cfg Config) *Backend {
+	switch cfg.Mode {
+	case ModeExternalName, ModeEndpointSlice:
+	default:
+		log.Fatalf("kubernetes-mode value %s is not a valid option (%s or %s)", cfg.Mode, ModeExternalName, ModeEndpointSlice)
+	}
+
+	return &Backend{
+		client:  client,
+		config:  cfg,
+		changed: make(chan struct{}, 1),
+		resolve: resolveIPv4,
+	}
+}
+
+// resolveIPv4 returns the sorted IPv4 addresses of a host name
+func resolveIPv4(host string) ([]string, error) {
+	ips, err := net.DefaultResolver.LookupIP(context.Background(), "ip4", host)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, ip.String())
+	}
+	sort.Strings(addresses)
+
+	return addresses, nil
+}
+
+// objectName returns a valid Kubernetes object name (RFC 1035 label) for a service ID
+func objectName(id string) string {
+	name := invalidNameCharsRegexp.ReplaceAllLiteralString(strings.ToLower(id), "-")
+	name = strings.Trim(name, "-")
+
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		name = strings.TrimRight(("db-" + name), "-")
+		if len(name) > 63 {
+			name = strings.TrimRight(name[:63], "-")
+		}
+	}
+
+	return name
+}
+
+// labels returns the labels marking an object as ours
+func (b *Backend) labels(service *config.Service) map[string]string {
+	return map[string]string{
+		labelManagedBy:   managedBy,
+		labelOwner:       objectName(b.config.OwnerID),
+		labelServiceName: objectName(service.ServiceName),
+	}
+}
+
+// selector returns the label selector matching the objects we own
+func (b *Backend) selector() string {
+	return labelManagedBy + "=" + managedBy + "," + labelOwner + "=" + objectName(b.config.OwnerID)
+}
+
+// isOwned returns true when the object carries our ownership labels
+func (b *Backend) isOwned(labels map[string]string) bool {
+	return labels[labelManagedBy] == managedBy && labels[labelOwner] == objectName(b.config.OwnerID)
+}
+
+// decodeService returns the service stored on a Kubernetes Service object
+func decodeService(svc *corev1.Service) (*config.Service, error) {
+	service := &config.Service{}
+	if err := json.Unmarshal([]byte(svc.Annotations[annotationSource]), service); err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+// serviceID returns the ID of the service stored on a Kubernetes Service object, or an empty string if it can not be decoded
+// and the object can be overwritten
+func serviceID(svc *corev1.Service) string {
+	service, err := decodeService(svc)
+	if err != nil {
+		return ""
+	}
+
+	return service.ServiceID
+}
+
+// notify wakes up the catalog reader to read the current objects
+func (b *Backend) notify() {
+	select {
+	case b.changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,257 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config/configtest"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/engine"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace = "databases"
+
+func newTestBackend(client *fake.Clientset, mode string) *Backend {
+	b := NewBackendWithClient(client, Config{Namespace: testNamespace, Mode: mode, OwnerID: "test"})
+	b.resolve = func(host string) ([]string, error) {
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}
+
+	return b
+}
+
+func testService(id, address string) *config.Service {
+	return configtest.Service(id, id, address)
+}
+
+func getService(t *testing.T, client *fake.Clientset, name string) *corev1.Service {
+	t.Helper()
+
+	svc, err := client.CoreV1().Services(testNamespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return svc
+}
+
+// source returns the same services on every pass
+type source config.Services
+
+func (s source) Services() config.Services {
+	return config.Services(s)
+}
+
+// observer fails the test on any failed operation
+type observer struct {
+	t   *testing.T
+	ops []string
+}
+
+func (o *observer) Done(op *engine.Operation, err error) {
+	if err != nil {
+		o.t.Errorf("%s %s failed: %s", op.Type, op.ServiceID, err)
+	}
+
+	o.ops = append(o.ops, op.Type+" "+op.ServiceID)
+}
+
+// sync reads the backend and syncs it with the services like a pass of the writer would
+func sync(t *testing.T, b *Backend, services ...*config.Service) []string {
+	t.Helper()
+
+	existing, err := b.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desired := make(source)
+	for _, service := range services {
+		service.ServiceMeta = map[string]string{config.MetaContentHash: service.ContentHash()}
+		desired[service.ServiceID] = service
+	}
+
+	e := &engine.Engine{
+		Backend: b,
+		Compare: func(existing, desired *config.Service) string {
+			if existing.ContentHash() != desired.ServiceMeta[config.MetaContentHash] {
+				return "ContentHash"
+			}
+			return ""
+		},
+	}
+
+	o := &observer{t: t}
+	e.Sync(desired, existing, nil, o)
+
+	return o.ops
+}
+
+func TestCreateUpdatePrune(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	b := newTestBackend(client, ModeExternalName)
+
+	ops := sync(t, b, testService("orders-db", "orders.rds.amazonaws.com"), testService("payments-db", "payments.rds.amazonaws.com"))
+	configtest.Equal(t, ops, []string{"write_service orders-db", "write_service payments-db"})
+
+	svc := getService(t, client, "orders-db")
+	configtest.Equal(t, svc.Spec.Type, corev1.ServiceTypeExternalName)
+	configtest.Equal(t, svc.Spec.ExternalName, "orders.rds.amazonaws.com")
+	configtest.Equal(t, svc.Spec.Ports[0].Port, 5432)
+	configtest.Equal(t, svc.Labels[labelOwner], "test")
+
+	// nothing changed
+	configtest.Equal(t, sync(t, b, testService("orders-db", "orders.rds.amazonaws.com"), testService("payments-db", "payments.rds.amazonaws.com")), []string{})
+
+	// orders moved and payments is gone
+	ops = sync(t, b, testService("orders-db", "orders-new.rds.amazonaws.com"))
+	configtest.Equal(t, ops, []string{"write_service orders-db", "delete_service payments-db"})
+	configtest.Equal(t, getService(t, client, "orders-db").Spec.ExternalName, "orders-new.rds.amazonaws.com")
+
+	if _, err := client.CoreV1().Services(testNamespace).Get(context.Background(), "payments-db", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("payments-db was not pruned (%v)", err)
+	}
+}
+
+func TestRefuseForeignObjects(t *testing.T) {
+	foreign := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders-db", Namespace: testNamespace, Labels: map[string]string{"app": "orders"}},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "elsewhere.example.com"},
+	}
+	client := fake.NewSimpleClientset(foreign)
+	b := newTestBackend(client, ModeExternalName)
+
+	services, err := b.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configtest.Equal(t, len(services), 0)
+
+	if err := b.WriteService(testService("orders-db", "orders.rds.amazonaws.com")); err == nil {
+		t.Error("overwrote a service without our ownership labels")
+	}
+
+	if err := b.DeleteService("orders-db", ""); err == nil {
+		t.Error("deleted a service without our ownership labels")
+	}
+
+	configtest.Equal(t, getService(t, client, "orders-db").Spec.ExternalName, "elsewhere.example.com")
+
+	// another owner is foreign too
+	other := NewBackendWithClient(client, Config{Namespace: testNamespace, Mode: ModeExternalName, OwnerID: "other"})
+	if err := other.WriteService(testService("payments-db", "payments.rds.amazonaws.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.WriteService(testService("payments-db", "payments.rds.amazonaws.com")); err == nil {
+		t.Error("overwrote a service of another owner")
+	}
+}
+
+func TestRefuseNameCollisions(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	b := newTestBackend(client, ModeExternalName)
+
+	if err := b.WriteService(testService("orders_db", "orders.rds.amazonaws.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.WriteService(testService("orders.db", "other.rds.amazonaws.com")); err == nil {
+		t.Error("two service IDs were written to the same Kubernetes service")
+	}
+
+	// deleting the other ID leaves the object of the first one alone
+	if err := b.DeleteService("orders.db", ""); err != nil {
+		t.Fatal(err)
+	}
+	configtest.Equal(t, getService(t, client, "orders-db").Spec.ExternalName, "orders.rds.amazonaws.com")
+}
+
+func TestRepairManualEdits(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	b := newTestBackend(client, ModeExternalName)
+	sync(t, b, testService("orders-db", "orders.rds.amazonaws.com"))
+
+	svc := getService(t, client, "orders-db")
+	svc.Spec.ExternalName = "elsewhere.example.com"
+	svc.Spec.Ports[0].Port = 3306
+	if _, err := client.CoreV1().Services(testNamespace).Update(context.Background(), svc, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := b.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configtest.Equal(t, services["orders-db"].ServiceAddress, "elsewhere.example.com")
+	configtest.Equal(t, services["orders-db"].ServicePort, 3306)
+
+	configtest.Equal(t, sync(t, b, testService("orders-db", "orders.rds.amazonaws.com")), []string{"write_service orders-db"})
+
+	svc = getService(t, client, "orders-db")
+	configtest.Equal(t, svc.Spec.ExternalName, "orders.rds.amazonaws.com")
+	configtest.Equal(t, svc.Spec.Ports[0].Port, 5432)
+}
+
+func TestEndpointSlice(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	b := newTestBackend(client, ModeEndpointSlice)
+
+	failing := testService("orders-db", "orders.rds.amazonaws.com")
+	failing.CheckStatus = "critical"
+	sync(t, b, failing)
+
+	svc := getService(t, client, "orders-db")
+	configtest.Equal(t, svc.Spec.Type, corev1.ServiceTypeClusterIP)
+	configtest.Equal(t, svc.Spec.ClusterIP, corev1.ClusterIPNone)
+
+	slice, err := client.DiscoveryV1().EndpointSlices(testNamespace).Get(context.Background(), "orders-db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configtest.Equal(t, slice.AddressType, discoveryv1.AddressTypeIPv4)
+	configtest.Equal(t, len(slice.Endpoints), 2)
+	configtest.Equal(t, slice.Endpoints[0].Addresses, []string{"10.0.0.1"})
+	configtest.Equal(t, *slice.Endpoints[0].Conditions.Ready, false)
+	configtest.Equal(t, slice.Labels[discoveryv1.LabelServiceName], "orders-db")
+
+	// the endpoint resolves to a new address after a failover
+	b.resolve = func(host string) ([]string, error) {
+		return []string{"10.0.0.3"}, nil
+	}
+	configtest.Equal(t, sync(t, b, failing), []string{"write_service orders-db"})
+
+	slice, err = client.DiscoveryV1().EndpointSlices(testNamespace).Get(context.Background(), "orders-db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configtest.Equal(t, len(slice.Endpoints), 1)
+	configtest.Equal(t, slice.Endpoints[0].Addresses, []string{"10.0.0.3"})
+}
+
+func TestModeSwitch(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	sync(t, newTestBackend(client, ModeExternalName), testService("orders-db", "orders.rds.amazonaws.com"))
+
+	b := newTestBackend(client, ModeEndpointSlice)
+	configtest.Equal(t, sync(t, b, testService("orders-db", "orders.rds.amazonaws.com")), []string{"write_service orders-db"})
+
+	svc := getService(t, client, "orders-db")
+	configtest.Equal(t, svc.Spec.Type, corev1.ServiceTypeClusterIP)
+	configtest.Equal(t, svc.Spec.ExternalName, "")
+
+	if _, err := client.DiscoveryV1().EndpointSlices(testNamespace).Get(context.Background(), "orders-db", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// and back
+	b = newTestBackend(client, ModeExternalName)
+	configtest.Equal(t, sync(t, b, testService("orders-db", "orders.rds.amazonaws.com")), []string{"write_service orders-db"})
+	configtest.Equal(t, getService(t, client, "orders-db").Spec.Type, corev1.ServiceTypeExternalName)
+	configtest.Equal(t, sync(t, b, testService("orders-db", "orders.rds.amazonaws.com")), []string{})
+}
@@ -0,0 +1,126 @@
+package kubernetes
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CatalogReader ...
+func (b *Backend) CatalogReader(state *config.CatalogState, nodeName string, quitCh chan int) {
+	logger := log.WithField("worker", "kubernetes-reader")
+	logger.Info("Starting Kubernetes catalog reader")
+
+	for {
+		services, err := b.read()
+		if err != nil {
+			logger.Errorf("Unable to list Kubernetes services: %s", err)
+		} else {
+			state.Lock()
+			state.Services = services
+			state.Unlock()
+			state.MarkReady()
+		}
+
+		select {
+		case <-quitCh:
+			return
+
+		case <-b.changed:
+			logger.Debug("Kubernetes services changed")
+
+		case <-time.After(b.config.PollInterval):
+		}
+	}
+}
+
+// read lists the Services we own and rebuilds the services from their annotation and live spec
+func (b *Backend) read() (config.Services, error) {
+	list, err := b.client.CoreV1().Services(b.config.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: b.selector(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices := make(map[string]*discoveryv1.EndpointSlice)
+	if b.config.Mode == ModeEndpointSlice {
+		sliceList, err := b.client.DiscoveryV1().EndpointSlices(b.config.Namespace).List(context.Background(), metav1.ListOptions{
+			LabelSelector: b.selector(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range sliceList.Items {
+			slices[sliceList.Items[i].Name] = &sliceList.Items[i]
+		}
+	}
+
+	services := make(config.Services)
+	for i := range list.Items {
+		svc := &list.Items[i]
+
+		service, err := decodeService(svc)
+		if err != nil {
+			log.Errorf("Could not decode service from Kubernetes service %s/%s: %s", svc.Namespace, svc.Name, err)
+			continue
+		}
+
+		b.overlay(service, svc, slices[svc.Name])
+		services[service.ServiceID] = service
+	}
+
+	return services, nil
+}
+
+// overlay replaces the fields of a service stored in the annotation with the live spec of the object,
+// so edits made outside of this tool are seen as changes and repaired on the next pass
+func (b *Backend) overlay(service *config.Service, svc *corev1.Service, slice *discoveryv1.EndpointSlice) {
+	service.ServicePort = 0
+	if ports := svc.Spec.Ports; len(ports) == 1 && ports[0].Name == "db" && ports[0].Protocol == corev1.ProtocolTCP {
+		service.ServicePort = int(ports[0].Port)
+	}
+
+	switch {
+	case b.config.Mode == ModeExternalName && svc.Spec.Type == corev1.ServiceTypeExternalName:
+		service.ServiceAddress = svc.Spec.ExternalName
+	case b.config.Mode == ModeEndpointSlice && svc.Spec.Type == corev1.ServiceTypeClusterIP && svc.Spec.ClusterIP == corev1.ClusterIPNone:
+		if !b.currentSlice(service, slice) {
+			service.ServiceAddress = ""
+		}
+	default:
+		// written in the other mode, or changed to another type
+		service.ServiceAddress = ""
+	}
+}
+
+// currentSlice returns false if the endpoint slice of a service is missing, or does not hold the addresses
+// the RDS endpoint currently resolves to, e.g. after a failover of a Single-AZ instance
+func (b *Backend) currentSlice(service *config.Service, slice *discoveryv1.EndpointSlice) bool {
+	if slice == nil || slice.AddressType != discoveryv1.AddressTypeIPv4 {
+		return false
+	}
+
+	addresses, err := b.resolve(service.ServiceAddress)
+	if err != nil {
+		// the write would fail the same way, keep the slice as it is
+		log.Warnf("Could not resolve %s: %s", service.ServiceAddress, err)
+		return true
+	}
+
+	current := make([]string, 0, len(slice.Endpoints))
+	for _, endpoint := range slice.Endpoints {
+		current = append(current, endpoint.Addresses...)
+	}
+	sort.Strings(current)
+
+	return strings.Join(current, ",") == strings.Join(addresses, ",")
+}
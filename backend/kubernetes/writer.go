@@ -0,0 +1,181 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// WriteService ...
+func (b *Backend) WriteService(service *config.Service) error {
+	svc, err := b.writeKubernetesService(service)
+	if err != nil {
+		return fmt.Errorf("could not write Kubernetes service for %s: %s", service.ServiceID, err)
+	}
+
+	if b.config.Mode == ModeEndpointSlice {
+		if err := b.writeEndpointSlice(service, svc); err != nil {
+			return fmt.Errorf("could not write Kubernetes endpoint slice for %s: %s", service.ServiceID, err)
+		}
+	}
+
+	b.notify()
+
+	return nil
+}
+
+func (b *Backend) writeKubernetesService(service *config.Service) (*corev1.Service, error) {
+	source, err := json.Marshal(service)
+	if err != nil {
+		return nil, err
+	}
+
+	desired := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        objectName(service.ServiceID),
+			Namespace:   b.config.Namespace,
+			Labels:      b.labels(service),
+			Annotations: map[string]string{annotationSource: string(source)},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:     "db",
+					Protocol: corev1.ProtocolTCP,
+					Port:     int32(service.ServicePort),
+				},
+			},
+		},
+	}
+
+	if b.config.Mode == ModeExternalName {
+		desired.Spec.Type = corev1.ServiceTypeExternalName
+		desired.Spec.ExternalName = service.ServiceAddress
+	} else {
+		desired.Spec.Type = corev1.ServiceTypeClusterIP
+		desired.Spec.ClusterIP = corev1.ClusterIPNone
+	}
+
+	services := b.client.CoreV1().Services(b.config.Namespace)
+
+	existing, err := services.Get(context.Background(), desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return services.Create(context.Background(), desired, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.isOwned(existing.Labels) {
+		return nil, fmt.Errorf("service %s/%s exists but is not managed by %s", existing.Namespace, existing.Name, b.config.OwnerID)
+	}
+
+	if id := serviceID(existing); id != "" && id != service.ServiceID {
+		return nil, fmt.Errorf("service IDs %s and %s both map to the Kubernetes service %s/%s", id, service.ServiceID, existing.Namespace, existing.Name)
+	}
+
+	// the cluster IP can not be changed, a service switching mode must be recreated
+	if existing.Spec.Type != desired.Spec.Type {
+		if err := services.Delete(context.Background(), existing.Name, metav1.DeleteOptions{}); err != nil {
+			return nil, err
+		}
+
+		return services.Create(context.Background(), desired, metav1.CreateOptions{})
+	}
+
+	existing.Labels = desired.Labels
+	existing.Annotations = desired.Annotations
+	existing.Spec.Ports = desired.Spec.Ports
+	existing.Spec.ExternalName = desired.Spec.ExternalName
+
+	return services.Update(context.Background(), existing, metav1.UpdateOptions{})
+}
+
+func (b *Backend) writeEndpointSlice(service *config.Service, svc *corev1.Service) error {
+	addresses, err := b.resolve(service.ServiceAddress)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s: %s", service.ServiceAddress, err)
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("%s has no IPv4 address", service.ServiceAddress)
+	}
+
+	// every address is its own endpoint, consumers may only use the first address of an endpoint
+	ready := service.CheckStatus != "critical"
+	endpoints := make([]discoveryv1.Endpoint, 0, len(addresses))
+	for _, address := range addresses {
+		endpoints = append(endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{address},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(ready)},
+		})
+	}
+
+	labels := b.labels(service)
+	labels[discoveryv1.LabelServiceName] = svc.Name
+	labels[discoveryv1.LabelManagedBy] = managedBy
+
+	desired := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      svc.Name,
+			Namespace: b.config.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: "v1",
+					Kind:       "Service",
+					Name:       svc.Name,
+					UID:        svc.UID,
+				},
+			},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+		Ports: []discoveryv1.EndpointPort{
+			{
+				Name:     ptr.To("db"),
+				Protocol: ptr.To(corev1.ProtocolTCP),
+				Port:     ptr.To(int32(service.ServicePort)),
+			},
+		},
+	}
+
+	slices := b.client.DiscoveryV1().EndpointSlices(b.config.Namespace)
+
+	existing, err := slices.Get(context.Background(), desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = slices.Create(context.Background(), desired, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if !b.isOwned(existing.Labels) {
+		return fmt.Errorf("endpoint slice %s/%s exists but is not managed by %s", existing.Namespace, existing.Name, b.config.OwnerID)
+	}
+
+	// the address type can not be changed, slices written by older versions must be recreated
+	if existing.AddressType != desired.AddressType {
+		if err := slices.Delete(context.Background(), existing.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+
+		_, err = slices.Create(context.Background(), desired, metav1.CreateOptions{})
+		return err
+	}
+
+	existing.Labels = desired.Labels
+	existing.OwnerReferences = desired.OwnerReferences
+	existing.Endpoints = desired.Endpoints
+	existing.Ports = desired.Ports
+
+	_, err = slices.Update(context.Background(), existing, metav1.UpdateOptions{})
+	return err
+}
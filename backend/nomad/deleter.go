@@ -0,0 +1,74 @@
+package nomad
+
+import (
+	"fmt"
+)
+
+// DeleteService removes the task group of the service from the job, its current registrations are
+// deleted by Flush once the job is registered
+func (b *Backend) DeleteService(service, node string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if err := b.load(); err != nil {
+		return err
+	}
+
+	name := groupName(service)
+	for i, group := range b.job.TaskGroups {
+		if *group.Name != name {
+			continue
+		}
+
+		b.job.TaskGroups = append(b.job.TaskGroups[:i], b.job.TaskGroups[i+1:]...)
+		b.removed = append(b.removed, name)
+		b.dirty = true
+
+		return nil
+	}
+
+	return nil
+}
+
+// DeleteCheck is a no-op, Nomad's service registry has no checks of its own
+func (b *Backend) DeleteCheck(check, node string) error {
+	return nil
+}
+
+// deleteRegistrations deletes the registrations made by the allocations of the removed task groups
+// right away, instead of leaving them in the registry until the allocations stopped
+func (b *Backend) deleteRegistrations(removed []string) error {
+	allocs, _, err := b.client.Jobs().Allocations(b.config.JobID, false, nil)
+	if err != nil {
+		return fmt.Errorf("could not list allocations of Nomad job %s: %s", b.config.JobID, err)
+	}
+
+	groups := make(map[string]bool, len(removed))
+	for _, group := range removed {
+		groups[group] = true
+	}
+
+	ids := make(map[string]bool)
+	for _, alloc := range allocs {
+		if groups[alloc.TaskGroup] {
+			ids[alloc.ID] = true
+		}
+	}
+
+	registrations, _, err := b.client.Jobs().Services(b.config.JobID, nil)
+	if err != nil {
+		return fmt.Errorf("could not list service registrations of Nomad job %s: %s", b.config.JobID, err)
+	}
+
+	for _, registration := range registrations {
+		if !ids[registration.AllocID] {
+			continue
+		}
+
+		if _, err := b.client.Services().Delete(registration.ServiceName, registration.ID, nil); err != nil && !isNotFound(err) {
+			return fmt.Errorf("could not delete Nomad service registration %s: %s", registration.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package nomad
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// metaService is the task group meta key holding the service the group registers
+	metaService = "aws-dynamic-consul-catalog-service"
+
+	// taskName is the name of the placeholder task keeping the allocation of every group running
+	taskName = "registration"
+)
+
+var (
+	invalidGroupCharsRegexp   = regexp.MustCompile("[^a-zA-Z0-9_.-]+")
+	invalidServiceCharsRegexp = regexp.MustCompile("[^a-z0-9-]+")
+)
+
+// Config ...
+type Config struct {
+	Address      string
+	Token        string
+	Region       string
+	Namespace    string
+	JobID        string
+	Datacenters  []string
+	Image        string
+	PollInterval time.Duration
+}
+
+// Backend registers the services in Nomad's service registry. Nomad has no API to register a
+// service directly, registrations only come from the service blocks of running allocations, so
+// every service is a task group of a single job we own, with a provider "nomad" service block
+// advertising the RDS endpoint and a placeholder task keeping the allocation alive
+type Backend struct {
+	client  *nomad.Client
+	config  Config
+	changed chan struct{}
+
+	// job is the job the operations of a pass are applied to, it is only registered by Flush
+	job   *nomad.Job
+	dirty bool
+
+	// removed holds the task groups removed from the job in this pass
+	removed []string
+	sync.Mutex
+}
+
+// NewBackend ...
+func NewBackend(cfg Config) *Backend {
+	client, err := nomad.NewClient(&nomad.Config{
+		Address:   cfg.Address,
+		SecretID:  cfg.Token,
+		Region:    cfg.Region,
+		Namespace: cfg.Namespace,
+	})
+	if err != nil {
+		log.Fatalf("Can not create Nomad client: %s", err)
+	}
+
+	return NewBackendWithClient(client, cfg)
+}
+
+// NewBackendWithClient ...
+func NewBackendWithClient(client *nomad.Client, cfg Config) *Backend {
+	if cfg.JobID == "" {
+		log.Fatal("nomad-job-id can not be empty")
+	}
+
+	return &Backend{
+		client:  client,
+		config:  cfg,
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// groupName returns a valid task group name for a service ID
+func groupName(id string) string {
+	return invalidGroupCharsRegexp.ReplaceAllLiteralString(id, "-")
+}
+
+// serviceName returns a valid Nomad service name (RFC 1123 label) for a service name
+func serviceName(name string) string {
+	name = invalidServiceCharsRegexp.ReplaceAllLiteralString(strings.ToLower(name), "-")
+	name = strings.Trim(name, "-")
+
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+
+	return name
+}
+
+// isOwned returns true when the job carries our ownership marker
+func isOwned(job *nomad.Job) bool {
+	return job.Meta[config.MetaManagedBy] == config.ManagedBy
+}
+
+// isNotFound returns true if the Nomad API answered with a 404
+func isNotFound(err error) bool {
+	var response nomad.UnexpectedResponseError
+	return errors.As(err, &response) && response.StatusCode() == http.StatusNotFound
+}
+
+// decodeService returns the service stored on a task group
+func decodeService(group *nomad.TaskGroup) (*config.Service, error) {
+	service := &config.Service{}
+	if err := json.Unmarshal([]byte(group.Meta[metaService]), service); err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+// notify wakes up the catalog reader to read the current job
+func (b *Backend) notify() {
+	select {
+	case b.changed <- struct{}{}:
+	default:
+	}
+}
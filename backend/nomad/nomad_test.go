@@ -0,0 +1,291 @@
+package nomad
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config/configtest"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/engine"
+	"k8s.io/utils/ptr"
+)
+
+const testJobID = "rds-catalog"
+
+// fakeNomad serves the job, allocation and service registration endpoints of a Nomad agent for a
+// single job, with one running allocation per task group
+type fakeNomad struct {
+	job     *nomad.Job
+	deleted []string
+	sync.Mutex
+}
+
+func (f *fakeNomad) serve(w http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/v1/job/"+testJobID:
+		if f.job == nil {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.job)
+
+	case req.Method == http.MethodPut && req.URL.Path == "/v1/jobs":
+		register := &nomad.JobRegisterRequest{}
+		json.NewDecoder(req.Body).Decode(register)
+
+		index := uint64(0)
+		if f.job != nil {
+			index = *f.job.JobModifyIndex
+		}
+		if register.EnforceIndex && register.JobModifyIndex != index {
+			http.Error(w, "job modify index does not match", http.StatusBadRequest)
+			return
+		}
+
+		register.Job.JobModifyIndex = ptr.To(index + 1)
+		f.job = register.Job
+		json.NewEncoder(w).Encode(&nomad.JobRegisterResponse{})
+
+	case req.Method == http.MethodDelete && req.URL.Path == "/v1/job/"+testJobID:
+		f.job.Stop = ptr.To(true)
+		json.NewEncoder(w).Encode(&nomad.JobDeregisterResponse{})
+
+	case req.Method == http.MethodGet && req.URL.Path == "/v1/job/"+testJobID+"/allocations":
+		allocs := make([]*nomad.AllocationListStub, 0)
+		for _, group := range f.job.TaskGroups {
+			allocs = append(allocs, &nomad.AllocationListStub{ID: "alloc-" + *group.Name, TaskGroup: *group.Name})
+		}
+		// the allocations of removed groups are still stopping
+		for _, id := range []string{"payments-db"} {
+			allocs = append(allocs, &nomad.AllocationListStub{ID: "alloc-" + id, TaskGroup: id})
+		}
+		json.NewEncoder(w).Encode(allocs)
+
+	case req.Method == http.MethodGet && req.URL.Path == "/v1/job/"+testJobID+"/services":
+		registrations := make([]*nomad.ServiceRegistration, 0)
+		for _, id := range []string{"orders-db", "payments-db"} {
+			registrations = append(registrations, &nomad.ServiceRegistration{ID: "_nomad-task-alloc-" + id, ServiceName: id, AllocID: "alloc-" + id})
+		}
+		json.NewEncoder(w).Encode(registrations)
+
+	case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/v1/service/"):
+		f.deleted = append(f.deleted, strings.TrimPrefix(req.URL.Path, "/v1/service/"))
+		json.NewEncoder(w).Encode(struct{}{})
+
+	default:
+		http.Error(w, "unexpected request "+req.Method+" "+req.URL.Path, http.StatusInternalServerError)
+	}
+}
+
+func newTestBackend(t *testing.T, f *fakeNomad) *Backend {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(server.Close)
+
+	client, err := nomad.NewClient(&nomad.Config{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewBackendWithClient(client, Config{JobID: testJobID, Datacenters: []string{"*"}, Image: "pause"})
+}
+
+func testService(id, address string) *config.Service {
+	return configtest.Service(id, id, address)
+}
+
+// source returns the same services on every pass
+type source config.Services
+
+func (s source) Services() config.Services {
+	return config.Services(s)
+}
+
+// observer fails the test on any failed operation
+type observer struct {
+	t   *testing.T
+	ops []string
+}
+
+func (o *observer) Done(op *engine.Operation, err error) {
+	if err != nil {
+		o.t.Errorf("%s %s failed: %s", op.Type, op.ServiceID, err)
+	}
+
+	o.ops = append(o.ops, op.Type+" "+op.ServiceID)
+}
+
+// pass reads the backend and syncs it with the services like a pass of the writer would
+func pass(t *testing.T, b *Backend, services ...*config.Service) []string {
+	t.Helper()
+
+	existing, err := b.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desired := make(source)
+	for _, service := range services {
+		service.ServiceMeta = map[string]string{config.MetaContentHash: service.ContentHash()}
+		desired[service.ServiceID] = service
+	}
+
+	e := &engine.Engine{
+		Backend: b,
+		Compare: func(existing, desired *config.Service) string {
+			if existing.ContentHash() != desired.ServiceMeta[config.MetaContentHash] {
+				return "ContentHash"
+			}
+			return ""
+		},
+	}
+
+	o := &observer{t: t}
+	e.Sync(desired, existing, nil, o)
+
+	return o.ops
+}
+
+func TestCreateUpdateDelete(t *testing.T) {
+	f := &fakeNomad{}
+	b := newTestBackend(t, f)
+
+	replica := configtest.Service("payments-db", "payments_db", "payments.rds.amazonaws.com", "replica")
+	ops := pass(t, b, testService("orders-db", "orders.rds.amazonaws.com"), replica)
+	configtest.Equal(t, ops, []string{"write_service orders-db", "write_service payments-db"})
+
+	configtest.Equal(t, *f.job.ID, testJobID)
+	configtest.Equal(t, f.job.Meta[config.MetaManagedBy], config.ManagedBy)
+	configtest.Equal(t, len(f.job.TaskGroups), 2)
+
+	group := f.job.LookupTaskGroup("payments-db")
+	configtest.Equal(t, *group.Count, 1)
+	configtest.Equal(t, group.Tasks[0].Config["image"], "pause")
+
+	spec := group.Services[0]
+	configtest.Equal(t, spec.Provider, "nomad")
+	configtest.Equal(t, spec.Name, "payments-db")
+	configtest.Equal(t, spec.Address, "payments.rds.amazonaws.com")
+	configtest.Equal(t, spec.PortLabel, "5432")
+	configtest.Equal(t, spec.Tags, []string{"replica"})
+
+	// nothing changed
+	replica = configtest.Service("payments-db", "payments_db", "payments.rds.amazonaws.com", "replica")
+	configtest.Equal(t, pass(t, b, testService("orders-db", "orders.rds.amazonaws.com"), replica), []string{})
+
+	// orders moved and payments is gone, a single job version holds both changes
+	ops = pass(t, b, testService("orders-db", "orders-new.rds.amazonaws.com"))
+	configtest.Equal(t, ops, []string{"write_service orders-db", "delete_service payments-db"})
+	configtest.Equal(t, *f.job.JobModifyIndex, 2)
+	configtest.Equal(t, len(f.job.TaskGroups), 1)
+	configtest.Equal(t, f.job.LookupTaskGroup("orders-db").Services[0].Address, "orders-new.rds.amazonaws.com")
+
+	// the registration of the removed group is deleted right away
+	configtest.Equal(t, f.deleted, []string{"payments-db/_nomad-task-alloc-payments-db"})
+
+	// the last service going away stops the job
+	configtest.Equal(t, pass(t, b), []string{"delete_service orders-db"})
+	configtest.Equal(t, *f.job.Stop, true)
+}
+
+func TestCriticalServiceIsScaledDown(t *testing.T) {
+	f := &fakeNomad{}
+	b := newTestBackend(t, f)
+
+	failing := testService("orders-db", "orders.rds.amazonaws.com")
+	failing.CheckStatus = "critical"
+	pass(t, b, failing)
+	configtest.Equal(t, *f.job.LookupTaskGroup("orders-db").Count, 0)
+
+	configtest.Equal(t, pass(t, b, testService("orders-db", "orders.rds.amazonaws.com")), []string{"write_service orders-db"})
+	configtest.Equal(t, *f.job.LookupTaskGroup("orders-db").Count, 1)
+}
+
+func TestRepairManualEdits(t *testing.T) {
+	f := &fakeNomad{}
+	b := newTestBackend(t, f)
+	pass(t, b, testService("orders-db", "orders.rds.amazonaws.com"))
+
+	spec := f.job.LookupTaskGroup("orders-db").Services[0]
+	spec.Address = "elsewhere.example.com"
+	spec.PortLabel = "3306"
+
+	services, err := b.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configtest.Equal(t, services["orders-db"].ServiceAddress, "elsewhere.example.com")
+	configtest.Equal(t, services["orders-db"].ServicePort, 3306)
+
+	configtest.Equal(t, pass(t, b, testService("orders-db", "orders.rds.amazonaws.com")), []string{"write_service orders-db"})
+
+	spec = f.job.LookupTaskGroup("orders-db").Services[0]
+	configtest.Equal(t, spec.Address, "orders.rds.amazonaws.com")
+	configtest.Equal(t, spec.PortLabel, "5432")
+
+	// a stopped job is started again
+	f.job.Stop = ptr.To(true)
+	configtest.Equal(t, pass(t, b, testService("orders-db", "orders.rds.amazonaws.com")), []string{"write_service orders-db"})
+	configtest.Equal(t, *f.job.Stop, false)
+}
+
+func TestRefuseForeignJob(t *testing.T) {
+	f := &fakeNomad{
+		job: &nomad.Job{ID: ptr.To(testJobID), JobModifyIndex: ptr.To(uint64(7)), Meta: map[string]string{"team": "payments"}},
+	}
+	b := newTestBackend(t, f)
+
+	if _, err := b.read(); err == nil {
+		t.Error("read a job without our ownership marker")
+	}
+
+	if err := b.WriteService(testService("orders-db", "orders.rds.amazonaws.com")); err == nil {
+		t.Error("wrote to a job without our ownership marker")
+	}
+
+	if err := b.DeleteService("orders-db", ""); err == nil {
+		t.Error("deleted from a job without our ownership marker")
+	}
+
+	configtest.Equal(t, *f.job.JobModifyIndex, 7)
+}
+
+func TestConcurrentJobChange(t *testing.T) {
+	f := &fakeNomad{}
+	b := newTestBackend(t, f)
+	pass(t, b, testService("orders-db", "orders.rds.amazonaws.com"))
+
+	if err := b.WriteService(testService("payments-db", "payments.rds.amazonaws.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	// someone registered the job after we read it
+	f.job.JobModifyIndex = ptr.To(*f.job.JobModifyIndex + 1)
+
+	if err := b.Flush(); err == nil {
+		t.Error("overwrote a job changed since it was read")
+	}
+	configtest.Equal(t, len(f.job.TaskGroups), 1)
+}
+
+func TestRefuseGroupNameCollisions(t *testing.T) {
+	f := &fakeNomad{}
+	b := newTestBackend(t, f)
+
+	if err := b.WriteService(testService("orders db", "orders.rds.amazonaws.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.WriteService(testService("orders/db", "other.rds.amazonaws.com")); err == nil {
+		t.Error("two service IDs were written to the same task group")
+	}
+}
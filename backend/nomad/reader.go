@@ -0,0 +1,104 @@
+package nomad
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// CatalogReader ...
+func (b *Backend) CatalogReader(state *config.CatalogState, nodeName string, quitCh chan int) {
+	logger := log.WithField("worker", "nomad-reader")
+	logger.Info("Starting Nomad catalog reader")
+
+	for {
+		services, err := b.read()
+		if err != nil {
+			logger.Errorf("Unable to read Nomad job %s: %s", b.config.JobID, err)
+		} else {
+			state.Lock()
+			state.Services = services
+			state.Unlock()
+			state.MarkReady()
+		}
+
+		select {
+		case <-quitCh:
+			return
+
+		case <-b.changed:
+			logger.Debug("Nomad job changed")
+
+		case <-time.After(b.config.PollInterval):
+		}
+	}
+}
+
+// read rebuilds the services from the task groups of our job, with the live service block laid over
+// the stored service so edits made outside of this tool are seen as changes and repaired on the next pass
+func (b *Backend) read() (config.Services, error) {
+	services := make(config.Services)
+
+	job, _, err := b.client.Jobs().Info(b.config.JobID, nil)
+	if isNotFound(err) {
+		return services, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !isOwned(job) {
+		return nil, fmt.Errorf("job %s exists but is not managed by %s", b.config.JobID, config.ManagedBy)
+	}
+
+	stopped := job.Stop != nil && *job.Stop
+
+	for _, group := range job.TaskGroups {
+		service, err := decodeService(group)
+		if err != nil {
+			log.Errorf("Could not decode service from Nomad task group %s: %s", *group.Name, err)
+			continue
+		}
+
+		overlay(service, group)
+
+		// a stopped job has no registrations, every service has to be written again
+		if stopped {
+			service.ServiceAddress = ""
+		}
+
+		services[service.ServiceID] = service
+	}
+
+	return services, nil
+}
+
+// overlay replaces the fields of a stored service with the live spec of its task group
+func overlay(service *config.Service, group *nomad.TaskGroup) {
+	if len(group.Services) != 1 || group.Services[0].Provider != "nomad" {
+		service.ServiceAddress = ""
+		return
+	}
+
+	spec := group.Services[0]
+	if spec.Name != serviceName(service.ServiceName) {
+		service.ServiceName = spec.Name
+	}
+	service.ServiceAddress = spec.Address
+	service.ServiceTags = spec.Tags
+
+	service.ServicePort = 0
+	if port, err := strconv.Atoi(spec.PortLabel); err == nil {
+		service.ServicePort = port
+	}
+
+	// critical services are kept out of the registry by scaling their group down
+	critical := group.Count != nil && *group.Count == 0
+	if critical != (service.CheckStatus == "critical") {
+		service.CheckStatus = ""
+	}
+}
@@ -0,0 +1,169 @@
+package nomad
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"k8s.io/utils/ptr"
+)
+
+// WriteService adds or replaces the task group of the service in the job, the job is registered by Flush
+func (b *Backend) WriteService(service *config.Service) error {
+	group, err := b.taskGroup(service)
+	if err != nil {
+		return fmt.Errorf("could not build Nomad task group for %s: %s", service.ServiceID, err)
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if err := b.load(); err != nil {
+		return err
+	}
+
+	for i, existing := range b.job.TaskGroups {
+		if *existing.Name != *group.Name {
+			continue
+		}
+
+		if current, err := decodeService(existing); err == nil && current.ServiceID != service.ServiceID {
+			return fmt.Errorf("task group %s already registers service %s", *group.Name, current.ServiceID)
+		}
+
+		b.job.TaskGroups[i] = group
+		b.dirty = true
+		return nil
+	}
+
+	b.job.AddTaskGroup(group)
+	b.dirty = true
+
+	return nil
+}
+
+// Flush registers the job once per pass if any operation changed it, so every pass is a single
+// job version and deployment. The registration fails if the job was changed since it was read
+func (b *Backend) Flush() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.dirty {
+		return nil
+	}
+
+	job, removed := b.job, b.removed
+	b.job, b.removed = nil, nil
+	b.dirty = false
+	defer b.notify()
+
+	modifyIndex := uint64(0)
+	if job.JobModifyIndex != nil {
+		modifyIndex = *job.JobModifyIndex
+	}
+
+	// a job needs at least one task group, the last service going away stops the job
+	if len(job.TaskGroups) == 0 {
+		if modifyIndex == 0 {
+			return nil
+		}
+
+		if _, _, err := b.client.Jobs().Deregister(b.config.JobID, false, nil); err != nil {
+			return fmt.Errorf("could not stop Nomad job %s: %s", b.config.JobID, err)
+		}
+
+		return b.deleteRegistrations(removed)
+	}
+
+	if _, _, err := b.client.Jobs().EnforceRegister(job, modifyIndex, nil); err != nil {
+		return fmt.Errorf("could not register Nomad job %s: %s", b.config.JobID, err)
+	}
+
+	if len(removed) == 0 || modifyIndex == 0 {
+		return nil
+	}
+
+	return b.deleteRegistrations(removed)
+}
+
+// load reads the job the operations of a pass are applied to, or starts a new one.
+// Must be called with the lock held
+func (b *Backend) load() error {
+	if b.job != nil {
+		return nil
+	}
+
+	job, _, err := b.client.Jobs().Info(b.config.JobID, nil)
+	if isNotFound(err) {
+		b.job = b.newJob()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read Nomad job %s: %s", b.config.JobID, err)
+	}
+
+	if !isOwned(job) {
+		return fmt.Errorf("job %s exists but is not managed by %s", b.config.JobID, config.ManagedBy)
+	}
+
+	job.Stop = ptr.To(false)
+	b.job = job
+
+	return nil
+}
+
+// newJob returns an empty job marked as ours
+func (b *Backend) newJob() *nomad.Job {
+	job := &nomad.Job{
+		ID:          ptr.To(b.config.JobID),
+		Name:        ptr.To(b.config.JobID),
+		Type:        ptr.To(nomad.JobTypeService),
+		Datacenters: b.config.Datacenters,
+		Meta:        map[string]string{config.MetaManagedBy: config.ManagedBy},
+	}
+
+	if b.config.Region != "" {
+		job.Region = ptr.To(b.config.Region)
+	}
+	if b.config.Namespace != "" {
+		job.Namespace = ptr.To(b.config.Namespace)
+	}
+
+	return job
+}
+
+// taskGroup returns the task group registering a service. Critical services are scaled down
+// to no allocation, so they are left out of the registry like Consul leaves out failing services
+func (b *Backend) taskGroup(service *config.Service) (*nomad.TaskGroup, error) {
+	source, err := json.Marshal(service)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 1
+	if service.CheckStatus == "critical" {
+		count = 0
+	}
+
+	task := nomad.NewTask(taskName, "docker").
+		SetConfig("image", b.config.Image).
+		Require(&nomad.Resources{CPU: ptr.To(10), MemoryMB: ptr.To(16)})
+
+	group := nomad.NewTaskGroup(groupName(service.ServiceID), count).
+		SetMeta(metaService, string(source)).
+		AddTask(task)
+
+	group.Services = []*nomad.Service{
+		{
+			Name:      serviceName(service.ServiceName),
+			Provider:  "nomad",
+			Address:   service.ServiceAddress,
+			PortLabel: strconv.Itoa(service.ServicePort),
+			Tags:      service.ServiceTags,
+		},
+	}
+
+	return group, nil
+}
@@ -0,0 +1,197 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+)
+
+const (
+	labelService   = "service"
+	labelServiceID = "service_id"
+	labelRole      = "role"
+	labelTags      = "tags"
+	labelMeta      = "meta_"
+
+	// labelSource holds the whole service as JSON, labels starting with __ are dropped by Prometheus
+	// after relabeling so it never becomes part of a series
+	labelSource = "__aws_dynamic_consul_catalog_service"
+)
+
+var invalidLabelCharsRegexp = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// targetGroup is a single entry of a file_sd_configs file
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// Format encodes the catalog as Prometheus file_sd_configs target groups
+type Format struct {
+	config Config
+}
+
+// Encode ...
+func (f *Format) Encode(services config.Services) ([]byte, error) {
+	ids := make([]string, 0, len(services))
+	for id := range services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	groups := make([]*targetGroup, 0, len(services))
+	for _, id := range ids {
+		group, err := f.targetGroup(services[id])
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, group)
+	}
+
+	data, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// Decode rebuilds the services from the target groups. The service stored in the source label is
+// used when present, with the live target laid over it so edits of the file are seen as changes.
+// Files written before the source label existed are decoded from the other labels, without check
+// information, so those services are rewritten once
+func (f *Format) Decode(data []byte) (config.Services, error) {
+	groups := make([]*targetGroup, 0)
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, err
+	}
+
+	services := make(config.Services)
+	for _, group := range groups {
+		id, ok := group.Labels[labelServiceID]
+		if !ok || len(group.Targets) == 0 {
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(group.Targets[0])
+		if err != nil {
+			continue
+		}
+		targetPort, _ := strconv.Atoi(port)
+
+		service := &config.Service{}
+		if source, ok := group.Labels[labelSource]; !ok || json.Unmarshal([]byte(source), service) != nil {
+			service = decodeLabels(group)
+		}
+
+		service.ServiceID = id
+		service.ServiceAddress = host
+
+		switch {
+		case f.config.ExporterPort == 0:
+			service.ServicePort = targetPort
+		case targetPort != f.config.ExporterPort:
+			// the service port is not in the target, a wrong exporter port can only be fixed by a write
+			service.ServicePort = 0
+		}
+
+		services[id] = service
+	}
+
+	return services, nil
+}
+
+// decodeLabels rebuilds a service from the labels of a target group written without the source label
+func decodeLabels(group *targetGroup) *config.Service {
+	service := &config.Service{
+		ServiceName: group.Labels[labelService],
+		ServiceTags: make([]string, 0),
+		ServiceMeta: make(map[string]string),
+	}
+
+	for _, tag := range strings.Split(group.Labels[labelTags], ",") {
+		if tag != "" {
+			service.ServiceTags = append(service.ServiceTags, tag)
+		}
+	}
+
+	for k, v := range group.Labels {
+		if strings.HasPrefix(k, labelMeta) {
+			service.ServiceMeta[strings.TrimPrefix(k, labelMeta)] = v
+		}
+	}
+
+	// the ownership markers are not valid label names, they are restored under their own keys
+	for _, key := range []string{config.MetaManagedBy, config.MetaManagedByInstance} {
+		label := invalidLabelCharsRegexp.ReplaceAllLiteralString(key, "_")
+		if v, ok := service.ServiceMeta[label]; ok {
+			delete(service.ServiceMeta, label)
+			service.ServiceMeta[key] = v
+		}
+	}
+
+	return service
+}
+
+func (f *Format) targetGroup(service *config.Service) (*targetGroup, error) {
+	source, err := json.Marshal(service)
+	if err != nil {
+		return nil, err
+	}
+
+	port := service.ServicePort
+	if f.config.ExporterPort != 0 {
+		port = f.config.ExporterPort
+	}
+
+	labels := map[string]string{
+		labelService:   service.ServiceName,
+		labelServiceID: service.ServiceID,
+		labelRole:      f.role(service.ServiceTags),
+		// wrapped in commas like the Consul service discovery, so relabel rules can match ",tag,"
+		labelTags:   "," + strings.Join(service.ServiceTags, ",") + ",",
+		labelSource: string(source),
+	}
+
+	// the change tracking meta keys change on every write, as labels they would create new series
+	for k, v := range service.ContentMeta() {
+		labels[labelMeta+invalidLabelCharsRegexp.ReplaceAllLiteralString(k, "_")] = v
+	}
+
+	return &targetGroup{
+		Targets: []string{net.JoinHostPort(service.ServiceAddress, strconv.Itoa(port))},
+		Labels:  labels,
+	}, nil
+}
+
+// role returns master, replica or standalone (an instance without replication)
+func (f *Format) role(tags []string) string {
+	isMaster, isReplica := false, false
+
+	for _, tag := range tags {
+		if tag == f.config.MasterTag {
+			isMaster = true
+		}
+
+		if tag == f.config.ReplicaTag {
+			isReplica = true
+		}
+	}
+
+	switch {
+	case isMaster && isReplica:
+		return "standalone"
+	case isMaster:
+		return "master"
+	case isReplica:
+		return "replica"
+	default:
+		return ""
+	}
+}
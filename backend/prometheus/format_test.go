@@ -0,0 +1,70 @@
+package prometheus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config/configtest"
+)
+
+func TestDecodeReproducesEncode(t *testing.T) {
+	for _, exporterPort := range []int{0, 9187} {
+		f := &Format{Config{ExporterPort: exporterPort, MasterTag: "master", ReplicaTag: "replica"}}
+
+		service := configtest.Service("orders-db", "orders", "orders.rds.amazonaws.com", "master")
+		service.CheckStatus = "critical"
+		service.CheckOutput = "Instance is failed"
+		service.ServiceMeta = map[string]string{"Engine": "postgres"}
+		service.ServiceMeta[config.MetaContentHash] = service.ContentHash()
+
+		data, err := f.Encode(config.Services{"orders-db": service})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		services, err := f.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := services["orders-db"]
+		configtest.Equal(t, decoded.ServicePort, 5432)
+		configtest.Equal(t, decoded.ContentHash(), service.ServiceMeta[config.MetaContentHash])
+	}
+}
+
+func TestDecodeSeesEditedTargets(t *testing.T) {
+	f := &Format{Config{ExporterPort: 9187}}
+
+	data, err := f.Encode(config.Services{"orders-db": configtest.Service("orders-db", "orders", "orders.rds.amazonaws.com")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := strings.Replace(string(data), "orders.rds.amazonaws.com:9187", "elsewhere.example.com:9100", 1)
+	services, err := f.Decode([]byte(edited))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configtest.Equal(t, services["orders-db"].ServiceAddress, "elsewhere.example.com")
+	configtest.Equal(t, services["orders-db"].ServicePort, 0)
+}
+
+func TestDecodeWithoutSourceLabel(t *testing.T) {
+	f := &Format{Config{}}
+
+	data := `[{"targets": ["orders.rds.amazonaws.com:5432"], "labels": {"service": "orders", "service_id": "orders-db", "tags": ",master,", "meta_Engine": "postgres"}}]`
+	services, err := f.Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := services["orders-db"]
+	configtest.Equal(t, service.ServiceName, "orders")
+	configtest.Equal(t, service.ServiceAddress, "orders.rds.amazonaws.com")
+	configtest.Equal(t, service.ServicePort, 5432)
+	configtest.Equal(t, service.ServiceTags, []string{"master"})
+	configtest.Equal(t, service.ServiceMeta["Engine"], "postgres")
+}
@@ -0,0 +1,21 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/backend/file"
+)
+
+// Config ...
+type Config struct {
+	Path         string
+	ExporterPort int
+	MasterTag    string
+	ReplicaTag   string
+	PollInterval time.Duration
+}
+
+// NewBackend returns a file backend writing Prometheus file_sd_configs target groups
+func NewBackend(config Config) *file.Backend {
+	return file.NewBackendWithFormat(config.Path, &Format{config}, config.PollInterval)
+}
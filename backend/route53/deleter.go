@@ -0,0 +1,44 @@
+package route53
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// DeleteService deletes the records of a service, only records with
+// a matching ownership TXT record are known and can be deleted
+func (b *Backend) DeleteService(service, node string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	records, ok := b.records[service]
+	if !ok || len(records) == 0 {
+		return nil
+	}
+
+	changes := make([]*route53.Change, 0)
+	for _, record := range records {
+		changes = append(changes, &route53.Change{
+			Action:            aws.String(route53.ChangeActionDelete),
+			ResourceRecordSet: record,
+		})
+	}
+
+	if err := b.change(changes, fmt.Sprintf("Delete %s", service)); err != nil {
+		return fmt.Errorf("could not delete Route 53 records for service %s: %s", service, err)
+	}
+
+	delete(b.records, service)
+	delete(b.remote, service)
+	delete(b.written, service)
+	b.notify()
+
+	return nil
+}
+
+// DeleteCheck is a no-op, checks only live on the service records
+func (b *Backend) DeleteCheck(check, node string) error {
+	return nil
+}
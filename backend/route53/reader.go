@@ -0,0 +1,172 @@
+package route53
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// CatalogReader ...
+func (b *Backend) CatalogReader(state *config.CatalogState, nodeName string, quitCh chan int) {
+	logger := log.WithField("worker", "route53-reader")
+	logger.Info("Starting Route 53 catalog reader")
+
+	timer := make(chan struct{}, 1)
+	timer <- struct{}{}
+
+	// the catalog is only ready once the zone has been read successfully
+	refreshed := false
+
+	for {
+		select {
+		case <-quitCh:
+			return
+
+		case <-timer:
+			logger.Debug("Reading Route 53 records")
+
+			if err := b.refresh(); err != nil {
+				logger.Errorf("Unable to read Route 53 records: %s", err)
+			} else {
+				refreshed = true
+			}
+
+			go func() {
+				select {
+				case <-quitCh:
+				case <-time.After(b.config.PollInterval):
+					timer <- struct{}{}
+				}
+			}()
+
+		case <-b.changed:
+			logger.Debug("Route 53 records changed")
+		}
+
+		services := b.snapshot()
+
+		state.Lock()
+		state.Services = services
+		state.Unlock()
+
+		if refreshed {
+			state.MarkReady()
+		}
+	}
+}
+
+// refresh reads the record sets we own from the zone and rebuilds the services from them
+func (b *Backend) refresh() error {
+	all := make(map[string]*route53.ResourceRecordSet)
+
+	err := b.client.ListResourceRecordSetsPages(&route53.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(b.config.ZoneID),
+	}, func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+		for _, record := range page.ResourceRecordSets {
+			all[recordKey(record)] = record
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	records := make(map[string][]*route53.ResourceRecordSet)
+	remote := make(config.Services)
+
+	for _, txt := range all {
+		if aws.StringValue(txt.Type) != route53.RRTypeTxt || !strings.HasPrefix(aws.StringValue(txt.Name), ownerPrefix) {
+			continue
+		}
+
+		id := aws.StringValue(txt.SetIdentifier)
+		if len(txt.ResourceRecords) != 1 || aws.StringValue(txt.ResourceRecords[0].Value) != b.ownerValue(id) {
+			continue
+		}
+		records[id] = append(records[id], txt)
+
+		name := strings.TrimPrefix(aws.StringValue(txt.Name), ownerPrefix)
+		cname, ok := all[route53.RRTypeCname+" "+name+" "+id]
+		if !ok || len(cname.ResourceRecords) != 1 {
+			continue
+		}
+		records[id] = append(records[id], cname)
+
+		serviceName, role, ok := b.parseRecordName(name)
+		if !ok {
+			continue
+		}
+
+		service, ok := remote[id]
+		if !ok {
+			service = &config.Service{
+				ServiceID:      id,
+				ServiceName:    serviceName,
+				ServiceAddress: strings.TrimSuffix(aws.StringValue(cname.ResourceRecords[0].Value), "."),
+				ServiceTags:    make([]string, 0),
+				// the owner record marks the service as ours, the instance marker is not kept in the zone
+				ServiceMeta: map[string]string{config.MetaManagedBy: config.ManagedBy},
+			}
+			remote[id] = service
+		}
+		service.ServiceTags = append(service.ServiceTags, role)
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	foreign := make(map[string]bool)
+	for key := range all {
+		foreign[key] = true
+	}
+	for _, owned := range records {
+		for _, record := range owned {
+			delete(foreign, recordKey(record))
+		}
+	}
+
+	b.records = records
+	b.foreign = foreign
+	b.remote = remote
+
+	return nil
+}
+
+// snapshot returns the services in the zone, preferring the last written
+// version of a service as long as its records still match it
+func (b *Backend) snapshot() config.Services {
+	b.Lock()
+	defer b.Unlock()
+
+	services := make(config.Services, len(b.remote))
+	for id, remote := range b.remote {
+		s := *remote
+
+		if written, ok := b.written[id]; ok && sameRecords(remote, written, b.roles(written.ServiceTags)) {
+			s = *written
+		}
+
+		services[id] = &s
+	}
+
+	return services
+}
+
+func sameRecords(remote, written *config.Service, roles []string) bool {
+	if !strings.EqualFold(remote.ServiceName, written.ServiceName) || remote.ServiceAddress != written.ServiceAddress {
+		return false
+	}
+
+	a := append([]string{}, remote.ServiceTags...)
+	b := append([]string{}, roles...)
+	sort.Strings(a)
+	sort.Strings(b)
+
+	return reflect.DeepEqual(a, b)
+}
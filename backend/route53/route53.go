@@ -0,0 +1,161 @@
+package route53
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// ownerPrefix is prepended to a record name to get the name of its ownership TXT record,
+// a CNAME can not share its name with any other record type
+const ownerPrefix = "_owner."
+
+// Config ...
+type Config struct {
+	ZoneID       string
+	Domain       string
+	OwnerID      string
+	TTL          int64
+	PollInterval time.Duration
+	MasterTag    string
+	ReplicaTag   string
+}
+
+// Backend ...
+type Backend struct {
+	client route53iface.Route53API
+	config Config
+
+	// records are the record sets we own in the zone, by service ID
+	records map[string][]*route53.ResourceRecordSet
+
+	// foreign are the keys of record sets in the zone we do not own
+	foreign map[string]bool
+
+	// remote are the services rebuilt from the records in the zone
+	remote config.Services
+
+	// written are the services as last written, DNS records can not hold
+	// all service fields so these are used when the records still match
+	written config.Services
+
+	changed chan struct{}
+	sync.Mutex
+}
+
+// NewBackend ...
+func NewBackend(config Config) *Backend {
+	if config.ZoneID == "" {
+		log.Fatal("A Route 53 hosted zone ID is required for the route53 backend")
+	}
+
+	return NewBackendWithClient(route53.New(session.Must(session.NewSession())), config)
+}
+
+// NewBackendWithClient ...
+func NewBackendWithClient(client route53iface.Route53API, cfg Config) *Backend {
+	cfg.Domain = strings.Trim(cfg.Domain, ".")
+
+	return &Backend{
+		client:  client,
+		config:  cfg,
+		records: make(map[string][]*route53.ResourceRecordSet),
+		foreign: make(map[string]bool),
+		remote:  make(config.Services),
+		written: make(config.Services),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// roles returns the record roles for a service, based on its tags
+func (b *Backend) roles(tags []string) []string {
+	roles := make([]string, 0)
+
+	for _, tag := range tags {
+		if tag == b.config.MasterTag || tag == b.config.ReplicaTag {
+			roles = append(roles, tag)
+		}
+	}
+
+	return roles
+}
+
+// recordName returns the fully qualified record name for a service and role
+func (b *Backend) recordName(service, role string) string {
+	return strings.ToLower(fmt.Sprintf("%s.%s.%s.", service, role, b.config.Domain))
+}
+
+// parseRecordName returns the service name and role from a record name
+func (b *Backend) parseRecordName(name string) (string, string, bool) {
+	for _, role := range []string{b.config.MasterTag, b.config.ReplicaTag} {
+		suffix := strings.ToLower(fmt.Sprintf(".%s.%s.", role, b.config.Domain))
+
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), role, true
+		}
+	}
+
+	return "", "", false
+}
+
+// ownerValue returns the TXT record value marking a record as ours
+func (b *Backend) ownerValue(serviceID string) string {
+	return fmt.Sprintf("\"heritage=aws-dynamic-consul-catalog,owner=%s,service-id=%s\"", b.config.OwnerID, serviceID)
+}
+
+// desiredRecords returns the CNAME and ownership TXT record sets for a service
+func (b *Backend) desiredRecords(service *config.Service) []*route53.ResourceRecordSet {
+	weight := int64(1)
+	if service.CheckStatus == "critical" {
+		weight = 0
+	}
+
+	records := make([]*route53.ResourceRecordSet, 0)
+	for _, role := range b.roles(service.ServiceTags) {
+		name := b.recordName(service.ServiceName, role)
+
+		records = append(records, &route53.ResourceRecordSet{
+			Name:          aws.String(name),
+			Type:          aws.String(route53.RRTypeCname),
+			SetIdentifier: aws.String(service.ServiceID),
+			Weight:        aws.Int64(weight),
+			TTL:           aws.Int64(b.config.TTL),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String(service.ServiceAddress)},
+			},
+		})
+
+		records = append(records, &route53.ResourceRecordSet{
+			Name:          aws.String(ownerPrefix + name),
+			Type:          aws.String(route53.RRTypeTxt),
+			SetIdentifier: aws.String(service.ServiceID),
+			Weight:        aws.Int64(weight),
+			TTL:           aws.Int64(b.config.TTL),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String(b.ownerValue(service.ServiceID))},
+			},
+		})
+	}
+
+	return records
+}
+
+// notify wakes up the catalog reader to publish the current services
+func (b *Backend) notify() {
+	select {
+	case b.changed <- struct{}{}:
+	default:
+	}
+}
+
+func recordKey(record *route53.ResourceRecordSet) string {
+	return aws.StringValue(record.Type) + " " + aws.StringValue(record.Name) + " " + aws.StringValue(record.SetIdentifier)
+}
@@ -0,0 +1,250 @@
+package route53
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config/configtest"
+)
+
+// fakeRoute53 is a single hosted zone applying change batches to its record sets
+type fakeRoute53 struct {
+	route53iface.Route53API
+
+	records map[string]*route53.ResourceRecordSet
+	batches []*route53.ChangeBatch
+}
+
+func newFakeRoute53(records ...*route53.ResourceRecordSet) *fakeRoute53 {
+	f := &fakeRoute53{records: make(map[string]*route53.ResourceRecordSet)}
+	for _, record := range records {
+		f.records[recordKey(record)] = record
+	}
+
+	return f
+}
+
+func (f *fakeRoute53) ListResourceRecordSetsPages(input *route53.ListResourceRecordSetsInput, fn func(*route53.ListResourceRecordSetsOutput, bool) bool) error {
+	page := &route53.ListResourceRecordSetsOutput{}
+	for _, record := range f.records {
+		page.ResourceRecordSets = append(page.ResourceRecordSets, record)
+	}
+
+	fn(page, true)
+	return nil
+}
+
+func (f *fakeRoute53) ChangeResourceRecordSets(input *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error) {
+	f.batches = append(f.batches, input.ChangeBatch)
+
+	for _, change := range input.ChangeBatch.Changes {
+		key := recordKey(change.ResourceRecordSet)
+
+		switch aws.StringValue(change.Action) {
+		case route53.ChangeActionUpsert:
+			f.records[key] = change.ResourceRecordSet
+		case route53.ChangeActionDelete:
+			if _, ok := f.records[key]; !ok {
+				return nil, fmt.Errorf("record %s not found", key)
+			}
+			delete(f.records, key)
+		}
+	}
+
+	return &route53.ChangeResourceRecordSetsOutput{}, nil
+}
+
+// changes returns the changes of a batch as sorted "ACTION key" strings
+func (f *fakeRoute53) changes(batch int) []string {
+	changes := make([]string, 0)
+	for _, change := range f.batches[batch].Changes {
+		changes = append(changes, aws.StringValue(change.Action)+" "+recordKey(change.ResourceRecordSet))
+	}
+	sort.Strings(changes)
+
+	return changes
+}
+
+func newTestBackend(client *fakeRoute53) *Backend {
+	return NewBackendWithClient(client, Config{
+		ZoneID:     "Z123",
+		Domain:     "db.example.com.",
+		OwnerID:    "test",
+		TTL:        60,
+		MasterTag:  "master",
+		ReplicaTag: "replica",
+	})
+}
+
+func TestWriteServiceUpsertsRecords(t *testing.T) {
+	client := newFakeRoute53()
+	b := newTestBackend(client)
+
+	if err := b.WriteService(configtest.Service("orders", "orders", "orders.rds.amazonaws.com", "master", "replica")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.batches) != 1 {
+		t.Fatalf("got %d change batches, want 1", len(client.batches))
+	}
+
+	configtest.Equal(t, client.changes(0), []string{
+		"UPSERT CNAME orders.master.db.example.com. orders",
+		"UPSERT CNAME orders.replica.db.example.com. orders",
+		"UPSERT TXT _owner.orders.master.db.example.com. orders",
+		"UPSERT TXT _owner.orders.replica.db.example.com. orders",
+	})
+
+	txt := client.records["TXT _owner.orders.master.db.example.com. orders"]
+	if value := aws.StringValue(txt.ResourceRecords[0].Value); value != `"heritage=aws-dynamic-consul-catalog,owner=test,service-id=orders"` {
+		t.Errorf("got ownership value %s", value)
+	}
+}
+
+func TestWriteServiceDeletesRemovedRoles(t *testing.T) {
+	client := newFakeRoute53()
+	b := newTestBackend(client)
+
+	if err := b.WriteService(configtest.Service("orders", "orders", "orders.rds.amazonaws.com", "master", "replica")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.WriteService(configtest.Service("orders", "orders", "orders.rds.amazonaws.com", "master")); err != nil {
+		t.Fatal(err)
+	}
+
+	configtest.Equal(t, client.changes(1), []string{
+		"DELETE CNAME orders.replica.db.example.com. orders",
+		"DELETE TXT _owner.orders.replica.db.example.com. orders",
+		"UPSERT CNAME orders.master.db.example.com. orders",
+		"UPSERT TXT _owner.orders.master.db.example.com. orders",
+	})
+}
+
+func TestDeleteService(t *testing.T) {
+	client := newFakeRoute53()
+	b := newTestBackend(client)
+
+	if err := b.WriteService(configtest.Service("orders", "orders", "orders.rds.amazonaws.com", "master")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.DeleteService("orders", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	configtest.Equal(t, client.changes(1), []string{
+		"DELETE CNAME orders.master.db.example.com. orders",
+		"DELETE TXT _owner.orders.master.db.example.com. orders",
+	})
+
+	if len(client.records) != 0 {
+		t.Errorf("got %d records left in the zone, want 0", len(client.records))
+	}
+
+	// unknown services have no records to delete
+	if err := b.DeleteService("orders", ""); err != nil || len(client.batches) != 2 {
+		t.Errorf("deleting an unknown service sent a change batch (%v)", err)
+	}
+}
+
+func TestWeightedReplicas(t *testing.T) {
+	client := newFakeRoute53()
+	b := newTestBackend(client)
+
+	healthy := configtest.Service("orders-db-1-replica", "orders", "db-1.rds.amazonaws.com", "replica")
+	failing := configtest.Service("orders-db-2-replica", "orders", "db-2.rds.amazonaws.com", "replica")
+	failing.CheckStatus = "critical"
+
+	for _, service := range []*config.Service{healthy, failing} {
+		if err := b.WriteService(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	weights := map[string]int64{}
+	for _, record := range client.records {
+		if aws.StringValue(record.Type) != route53.RRTypeCname {
+			continue
+		}
+
+		if name := aws.StringValue(record.Name); name != "orders.replica.db.example.com." {
+			t.Errorf("got record name %s", name)
+		}
+		weights[aws.StringValue(record.ResourceRecords[0].Value)] = aws.Int64Value(record.Weight)
+	}
+
+	want := map[string]int64{"db-1.rds.amazonaws.com": 1, "db-2.rds.amazonaws.com": 0}
+	if fmt.Sprint(weights) != fmt.Sprint(want) {
+		t.Errorf("got weights %v, want %v", weights, want)
+	}
+}
+
+func TestWriteServiceRefusesForeignRecords(t *testing.T) {
+	client := newFakeRoute53(&route53.ResourceRecordSet{
+		Name:            aws.String("orders.master.db.example.com."),
+		Type:            aws.String(route53.RRTypeCname),
+		SetIdentifier:   aws.String("orders"),
+		Weight:          aws.Int64(1),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("elsewhere.example.com")}},
+	})
+	b := newTestBackend(client)
+
+	if err := b.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.WriteService(configtest.Service("orders", "orders", "orders.rds.amazonaws.com", "master")); err == nil {
+		t.Fatal("overwrote a record owned by someone else")
+	}
+
+	if len(client.batches) != 0 {
+		t.Errorf("got %d change batches, want 0", len(client.batches))
+	}
+}
+
+func TestRefreshRebuildsServices(t *testing.T) {
+	writer := newTestBackend(newFakeRoute53())
+	client := writer.client.(*fakeRoute53)
+
+	if err := writer.WriteService(configtest.Service("orders", "orders", "orders.rds.amazonaws.com.", "master", "replica")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a service of another owner, and a CNAME whose ownership record is missing
+	other := NewBackendWithClient(client, Config{ZoneID: "Z123", Domain: "db.example.com", OwnerID: "other", MasterTag: "master", ReplicaTag: "replica"})
+	if err := other.WriteService(configtest.Service("payments", "payments", "payments.rds.amazonaws.com", "master")); err != nil {
+		t.Fatal(err)
+	}
+	delete(client.records, "TXT _owner.orders.replica.db.example.com. orders")
+
+	b := newTestBackend(client)
+	if err := b.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	services := b.snapshot()
+	if len(services) != 1 {
+		t.Fatalf("got %d services, want 1", len(services))
+	}
+
+	orders := services["orders"]
+	if orders == nil {
+		t.Fatal("service orders was not rebuilt")
+	}
+
+	if orders.ServiceName != "orders" || orders.ServiceAddress != "orders.rds.amazonaws.com" {
+		t.Errorf("got service %s at %s", orders.ServiceName, orders.ServiceAddress)
+	}
+	configtest.Equal(t, orders.ServiceTags, []string{"master"})
+
+	// records without our ownership record are foreign
+	if !b.foreign["CNAME orders.replica.db.example.com. orders"] || !b.foreign["CNAME payments.master.db.example.com. payments"] {
+		t.Errorf("got foreign records %v", b.foreign)
+	}
+}
@@ -0,0 +1,77 @@
+package route53
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+)
+
+// WriteService ...
+func (b *Backend) WriteService(service *config.Service) error {
+	b.Lock()
+	defer b.Unlock()
+
+	desired := b.desiredRecords(service)
+	if len(desired) == 0 {
+		return fmt.Errorf("service %s has no %s or %s tag, not writing any Route 53 record", service.ServiceID, b.config.MasterTag, b.config.ReplicaTag)
+	}
+
+	changes := make([]*route53.Change, 0)
+	keep := make(map[string]bool)
+
+	for _, record := range desired {
+		if b.foreign[recordKey(record)] {
+			return fmt.Errorf("record %s for service %s exists but is not owned by %s, not overwriting it", aws.StringValue(record.Name), service.ServiceID, b.config.OwnerID)
+		}
+
+		keep[recordKey(record)] = true
+		changes = append(changes, &route53.Change{
+			Action:            aws.String(route53.ChangeActionUpsert),
+			ResourceRecordSet: record,
+		})
+	}
+
+	// the service changed name or role, remove the records it no longer has
+	for _, record := range b.records[service.ServiceID] {
+		if keep[recordKey(record)] {
+			continue
+		}
+
+		changes = append(changes, &route53.Change{
+			Action:            aws.String(route53.ChangeActionDelete),
+			ResourceRecordSet: record,
+		})
+	}
+
+	if err := b.change(changes, fmt.Sprintf("Update %s", service.ServiceID)); err != nil {
+		return fmt.Errorf("could not write Route 53 records for service %s: %s", service.ServiceID, err)
+	}
+
+	s := *service
+	b.written[service.ServiceID] = &s
+	b.records[service.ServiceID] = desired
+	b.remote[service.ServiceID] = &config.Service{
+		ServiceID:      service.ServiceID,
+		ServiceName:    service.ServiceName,
+		ServiceAddress: service.ServiceAddress,
+		ServiceTags:    b.roles(service.ServiceTags),
+	}
+	b.notify()
+
+	return nil
+}
+
+// change sends a single change batch for the zone
+func (b *Backend) change(changes []*route53.Change, comment string) error {
+	_, err := b.client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(b.config.ZoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Comment: aws.String("aws-dynamic-consul-catalog: " + comment),
+			Changes: changes,
+		},
+	})
+
+	return err
+}
@@ -0,0 +1,30 @@
+// Package configtest holds the fixtures shared by the tests of the backends
+package configtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+)
+
+// Service returns a passing service on port 5432
+func Service(id, name, address string, tags ...string) *config.Service {
+	return &config.Service{
+		ServiceID:      id,
+		ServiceName:    name,
+		ServiceAddress: address,
+		ServicePort:    5432,
+		ServiceTags:    tags,
+		CheckStatus:    "passing",
+	}
+}
+
+// Equal fails the test if got and want do not print the same
+func Equal(t testing.TB, got, want interface{}) {
+	t.Helper()
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got\n  %v\nwant\n  %v", got, want)
+	}
+}
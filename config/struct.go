@@ -1,17 +1,55 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/aws/aws-sdk-go/service/rds"
 )
 
+const (
+	// ManagedBy is the value of the MetaManagedBy service meta key on every service we write
+	ManagedBy = "aws-dynamic-consul-catalog"
+
+	// MetaManagedBy is the service meta key marking a service as written by us
+	MetaManagedBy = "managed-by"
+
+	// MetaManagedByInstance is the service meta key holding the instance ID of the daemon that wrote the service
+	MetaManagedByInstance = "managed-by-instance"
+
+	// CheckIDPrefix is prepended to the service ID to form the ID of the check we write for a service
+	CheckIDPrefix = "service:"
+
+	// MetaContentHash is the service meta key holding the ContentHash of the service when it was written
+	MetaContentHash = "content-hash"
+
+	// MetaLastSync is the service meta key holding when the service was last written (RFC 3339)
+	MetaLastSync = "last-sync"
+
+	// NodeMetaGroup is the node meta key holding the --consul-node-name on every node we register
+	// in node-per-instance and node-per-az mode, used to find our nodes back
+	NodeMetaGroup = "aws-dynamic-consul-catalog"
+)
+
 // Backend ...
 type Backend interface {
 	CatalogReader(state *CatalogState, nodeName string, quitCh chan int)
-	WriteService(service *Service)
-	DeleteCheck(check, node string)
-	DeleteService(service, node string)
+	WriteService(service *Service) error
+	DeleteCheck(check, node string) error
+	DeleteService(service, node string) error
+}
+
+// Flusher is implemented by backends that buffer the operations of a pass, Flush applies them at once
+type Flusher interface {
+	Flush() error
+}
+
+// Source produces the services a backend catalog should contain
+type Source interface {
+	Services() Services
 }
 
 // Config ...
@@ -21,12 +59,6 @@ type Config struct {
 	ConsulRDSReplicaTag string
 }
 
-// SeenCatalog ...
-type SeenCatalog struct {
-	Services []string
-	Checks   []string
-}
-
 // Tags ...
 type Tags map[string]string
 
@@ -36,6 +68,17 @@ type DBInstance struct {
 	Tags Tags
 }
 
+// Snapshot is the set of RDS instances read in a single pass
+type Snapshot struct {
+	Instances []*DBInstance
+
+	// Trigger is why the pass ran (startup, timer or signal)
+	Trigger string
+
+	// SyncID identifies the pass in logs and audit records
+	SyncID string
+}
+
 // Filters ...
 type Filters map[string]string
 
@@ -47,32 +90,129 @@ type Service struct {
 	ServicePort    int
 	ServiceTags    []string
 	ServiceMeta    map[string]string
+	NodeMeta       map[string]string
+	NodeAddress    string `json:",omitempty"`
 	CheckID        string
 	CheckNode      string
 	CheckNotes     string
 	CheckStatus    string
 	CheckOutput    string
+
+	// Checks are all the checks of the service read from the catalog, including the one above
+	Checks Checks `json:",omitempty"`
 }
 
-// Services ...
-type Services map[string]*Service
+// Check is a health check read from the catalog, attached to a service or to a node when ServiceID is empty
+type Check struct {
+	CheckID   string
+	Node      string
+	ServiceID string
+	Name      string
+	Status    string
+	Output    string
+	Notes     string
+}
+
+// Checks ...
+type Checks []*Check
+
+// IsOwned returns true if the check ID follows the naming of the checks we write
+func (c *Check) IsOwned() bool {
+	return c.ServiceID != "" && c.CheckID == CheckIDPrefix+c.ServiceID
+}
+
+// IsOwnedBy returns true if the service carries our ownership markers for the given instance ID
+func (s *Service) IsOwnedBy(instanceID string) bool {
+	return s.ServiceMeta[MetaManagedBy] == ManagedBy && s.ServiceMeta[MetaManagedByInstance] == instanceID
+}
 
-func (s Services) GetSeen() SeenCatalog {
-	seen := SeenCatalog{
-		Services: make([]string, 0),
-		Checks:   make([]string, 0),
+// IsForeign returns true if the service was not written by us, or was written by another instance.
+// Backends that can not store the instance marker only set MetaManagedBy on the services they own
+func (s *Service) IsForeign(instanceID string) bool {
+	if s.ServiceMeta[MetaManagedBy] != ManagedBy {
+		return true
 	}
 
-	for _, service := range s {
-		seen.Checks = append(seen.Checks, service.CheckID)
-		seen.Services = append(seen.Services, service.ServiceID)
+	if instance, ok := s.ServiceMeta[MetaManagedByInstance]; ok && instance != instanceID {
+		return true
 	}
 
-	return seen
+	return false
+}
+
+// ContentMeta returns the service meta without the change tracking keys
+func (s *Service) ContentMeta() map[string]string {
+	meta := make(map[string]string, len(s.ServiceMeta))
+	for k, v := range s.ServiceMeta {
+		if k != MetaContentHash && k != MetaLastSync {
+			meta[k] = v
+		}
+	}
+
+	return meta
+}
+
+// ContentHash returns a hash of everything that is compared to decide if a service changed,
+// the change tracking meta keys are left out
+func (s *Service) ContentHash() string {
+	tags := append([]string{}, s.ServiceTags...)
+	sort.Strings(tags)
+
+	meta := s.ContentMeta()
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %q %d %q %q %q\n", s.ServiceID, s.ServiceName, s.CheckNode, s.ServiceAddress, s.ServicePort, s.CheckNotes, s.CheckStatus, s.CheckOutput)
+	fmt.Fprintf(h, "%q\n", tags)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%q=%q\n", k, meta[k])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Services ...
+type Services map[string]*Service
+
+// IDs returns the service IDs in sorted order
+func (s Services) IDs() []string {
+	ids := make([]string, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
 }
 
 // CatalogState ...
 type CatalogState struct {
 	Services Services
+
+	// Checks are the checks that do not belong to any service in Services, node-level
+	// checks and orphaned checks of services that are gone
+	Checks Checks
 	sync.Mutex
+
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+// NewCatalogState ...
+func NewCatalogState() *CatalogState {
+	return &CatalogState{ready: make(chan struct{})}
+}
+
+// MarkReady signals that the remote catalog has been loaded at least once
+func (s *CatalogState) MarkReady() {
+	s.readyOnce.Do(func() { close(s.ready) })
+}
+
+// Ready is closed once the remote catalog has been loaded
+func (s *CatalogState) Ready() <-chan struct{} {
+	return s.ready
 }
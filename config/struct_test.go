@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestIsForeign(t *testing.T) {
+	tests := []struct {
+		name    string
+		meta    map[string]string
+		foreign bool
+	}{
+		{name: "ours", meta: map[string]string{MetaManagedBy: ManagedBy, MetaManagedByInstance: "rds"}},
+		{name: "another instance", meta: map[string]string{MetaManagedBy: ManagedBy, MetaManagedByInstance: "rds-eu"}, foreign: true},
+		{name: "another tool", meta: map[string]string{MetaManagedBy: "terraform", MetaManagedByInstance: "rds"}, foreign: true},
+		{name: "no marker", meta: map[string]string{"owner": "someone else"}, foreign: true},
+		{name: "no meta", foreign: true},
+		// route53 only keeps the managed-by marker
+		{name: "no instance marker", meta: map[string]string{MetaManagedBy: ManagedBy}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &Service{ServiceID: "orders", ServiceMeta: test.meta}
+			if got := service.IsForeign("rds"); got != test.foreign {
+				t.Errorf("IsForeign() = %v, want %v", got, test.foreign)
+			}
+		})
+	}
+}
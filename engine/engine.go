@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+)
+
+// Operation types
+const (
+	WriteService  = "write_service"
+	DeleteService = "delete_service"
+	DeleteCheck   = "delete_check"
+
+	// Flush is only reported to the Observer, when flushing a buffering backend fails
+	Flush = "flush"
+)
+
+// Operation is a single mutation of a backend catalog
+type Operation struct {
+	Type      string
+	ServiceID string
+	CheckID   string
+	Node      string
+
+	// Changed is the first field that differs from the existing service, empty for new services and deletes
+	Changed string
+
+	// Moved is set on the delete of a service from the node it moved away from
+	Moved bool
+
+	Before *config.Service
+	After  *config.Service
+}
+
+// CompareFunc returns the first field that differs between an existing and a desired service, or an empty string if they are identical
+type CompareFunc func(existing, desired *config.Service) string
+
+// Engine reconciles the catalog of a backend with the desired services of a source
+type Engine struct {
+	Backend config.Backend
+
+	// DefaultNode is the node of existing services that do not have one
+	DefaultNode string
+
+	Compare CompareFunc
+}
+
+// Plan returns the operations turning the existing services into the desired services, and removing
+// the orphaned checks we wrote. Writes come first, then service deletes and check deletes, each sorted by ID
+func (e *Engine) Plan(desired, existing config.Services, orphans config.Checks) []*Operation {
+	ops := make([]*Operation, 0)
+
+	checks := make(map[string]bool, len(desired))
+	for _, service := range desired {
+		checks[service.CheckID] = true
+	}
+
+	for _, id := range desired.IDs() {
+		service := desired[id]
+
+		current, ok := existing[id]
+		if !ok {
+			ops = append(ops, &Operation{Type: WriteService, ServiceID: id, CheckID: service.CheckID, Node: service.CheckNode, After: service})
+			continue
+		}
+
+		changed := e.Compare(current, service)
+		if changed == "" {
+			continue
+		}
+
+		// service IDs are unique per node, remove the service from the node it moved away from
+		if current.CheckNode != "" && current.CheckNode != service.CheckNode {
+			ops = append(ops, &Operation{Type: DeleteService, ServiceID: id, Node: current.CheckNode, Changed: changed, Moved: true, Before: current})
+		}
+
+		ops = append(ops, &Operation{Type: WriteService, ServiceID: id, CheckID: service.CheckID, Node: service.CheckNode, Changed: changed, Before: current, After: service})
+	}
+
+	existingIDs := existing.IDs()
+
+	for _, id := range existingIDs {
+		if _, ok := desired[id]; !ok {
+			ops = append(ops, &Operation{Type: DeleteService, ServiceID: id, Node: e.node(existing[id]), Before: existing[id]})
+		}
+	}
+
+	deletes := make([]*Operation, 0)
+
+	for _, id := range existingIDs {
+		service := existing[id]
+		if service.CheckID != "" && !checks[service.CheckID] {
+			deletes = append(deletes, &Operation{Type: DeleteCheck, CheckID: service.CheckID, Node: e.node(service), Before: service})
+		}
+	}
+
+	for _, check := range orphans {
+		if check.IsOwned() && !checks[check.CheckID] {
+			deletes = append(deletes, &Operation{Type: DeleteCheck, CheckID: check.CheckID, Node: check.Node})
+		}
+	}
+
+	sort.SliceStable(deletes, func(i, j int) bool {
+		return deletes[i].CheckID < deletes[j].CheckID
+	})
+
+	return append(ops, deletes...)
+}
+
+// Run applies a single operation to the backend
+func (e *Engine) Run(op *Operation) error {
+	switch op.Type {
+	case WriteService:
+		return e.Backend.WriteService(op.After)
+	case DeleteService:
+		return e.Backend.DeleteService(op.ServiceID, op.Node)
+	case DeleteCheck:
+		return e.Backend.DeleteCheck(op.CheckID, op.Node)
+	default:
+		return fmt.Errorf("unknown operation %s", op.Type)
+	}
+}
+
+// Sync reconciles the backend with the source, the observer is told the outcome of every operation.
+// Backends buffering the operations are flushed at the end
+func (e *Engine) Sync(source config.Source, existing config.Services, orphans config.Checks, observer Observer) {
+	for _, op := range e.Plan(source.Services(), existing, orphans) {
+		observer.Done(op, e.Run(op))
+	}
+
+	if flusher, ok := e.Backend.(config.Flusher); ok {
+		if err := flusher.Flush(); err != nil {
+			observer.Done(&Operation{Type: Flush}, err)
+		}
+	}
+}
+
+func (e *Engine) node(service *config.Service) string {
+	if service.CheckNode == "" {
+		return e.DefaultNode
+	}
+
+	return service.CheckNode
+}
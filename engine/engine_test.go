@@ -0,0 +1,264 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config/configtest"
+)
+
+// benchmarkCatalogs returns n desired and n existing services, where 10% of the desired services
+// are new, 10% of the existing services are gone and 10% of the remaining ones changed address
+func benchmarkCatalogs(n int) (config.Services, config.Services) {
+	desired := make(config.Services, n)
+	existing := make(config.Services, n)
+
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("service-%05d", i)
+		desired[id] = &config.Service{ServiceID: id, ServiceName: id, ServiceAddress: id + ".rds.amazonaws.com", CheckID: config.CheckIDPrefix + id, CheckNode: "rds"}
+
+		if i%10 == 0 {
+			id = fmt.Sprintf("gone-%05d", i)
+		}
+
+		address := id + ".rds.amazonaws.com"
+		if i%10 == 5 {
+			address = "old-" + address
+		}
+
+		existing[id] = &config.Service{ServiceID: id, ServiceName: id, ServiceAddress: address, CheckID: config.CheckIDPrefix + id, CheckNode: "rds"}
+	}
+
+	return desired, existing
+}
+
+func compareAddress(existing, desired *config.Service) string {
+	if existing.ServiceAddress != desired.ServiceAddress {
+		return "ServiceAddress"
+	}
+
+	return ""
+}
+
+// testService returns a service on the given node with the check we write for it
+func testService(id, address, node string) *config.Service {
+	service := configtest.Service(id, id, address)
+	service.CheckID = config.CheckIDPrefix + id
+	service.CheckNode = node
+	return service
+}
+
+// describe renders an operation as "type id@node", with the changed field or the moved flag when set
+func describe(op *Operation) string {
+	id := op.ServiceID
+	if op.Type == DeleteCheck {
+		id = op.CheckID
+	}
+
+	s := fmt.Sprintf("%s %s@%s", op.Type, id, op.Node)
+	if op.Changed != "" {
+		s += " " + op.Changed
+	}
+	if op.Moved {
+		s += " moved"
+	}
+
+	return s
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		desired  config.Services
+		existing config.Services
+		orphans  config.Checks
+		want     []string
+	}{
+		{
+			name: "writes, then service deletes, then check deletes, each sorted by ID",
+			desired: config.Services{
+				"orders":   testService("orders", "orders.rds", "rds"),
+				"billing":  testService("billing", "billing.rds", "rds"),
+				"payments": testService("payments", "new.payments.rds", "rds"),
+			},
+			existing: config.Services{
+				"zebra":    testService("zebra", "zebra.rds", "rds"),
+				"payments": testService("payments", "payments.rds", "rds"),
+				"alpha":    testService("alpha", "alpha.rds", "rds"),
+			},
+			orphans: config.Checks{
+				{CheckID: "service:gone", ServiceID: "gone", Node: "rds"},
+			},
+			want: []string{
+				"write_service billing@rds",
+				"write_service orders@rds",
+				"write_service payments@rds ServiceAddress",
+				"delete_service alpha@rds",
+				"delete_service zebra@rds",
+				"delete_check service:alpha@rds",
+				"delete_check service:gone@rds",
+				"delete_check service:zebra@rds",
+			},
+		},
+		{
+			name:     "unchanged services are skipped",
+			desired:  config.Services{"orders": testService("orders", "orders.rds", "rds")},
+			existing: config.Services{"orders": testService("orders", "orders.rds", "rds")},
+			want:     []string{},
+		},
+		{
+			name:     "a service moving to another node is deleted from the old node before the write",
+			desired:  config.Services{"orders": testService("orders", "orders.rds", "rds-us-east-1b")},
+			existing: config.Services{"orders": testService("orders", "orders.rds", "rds")},
+			want: []string{
+				"delete_service orders@rds CheckNode moved",
+				"write_service orders@rds-us-east-1b CheckNode",
+			},
+		},
+		{
+			name:     "existing services without a node are deleted from the default node",
+			existing: config.Services{"orders": testService("orders", "orders.rds", "")},
+			want: []string{
+				"delete_service orders@rds",
+				"delete_check service:orders@rds",
+			},
+		},
+		{
+			name:    "only orphaned checks we wrote are deleted",
+			desired: config.Services{"orders": testService("orders", "orders.rds", "rds")},
+			existing: config.Services{
+				"orders": testService("orders", "orders.rds", "rds"),
+			},
+			orphans: config.Checks{
+				{CheckID: "service:gone", ServiceID: "gone", Node: "rds"},
+				{CheckID: "service:orders", ServiceID: "orders", Node: "rds"},
+				{CheckID: "gone-tcp", ServiceID: "gone", Node: "rds"},
+				{CheckID: "maintenance", Node: "rds"},
+			},
+			want: []string{
+				"delete_check service:gone@rds",
+			},
+		},
+		{
+			name:    "the old check of an existing service is deleted when its check ID changed",
+			desired: config.Services{"orders": testService("orders", "orders.rds", "rds")},
+			existing: config.Services{
+				"orders": func() *config.Service {
+					service := testService("orders", "orders.rds", "rds")
+					service.CheckID = "orders-legacy"
+					return service
+				}(),
+			},
+			want: []string{
+				"write_service orders@rds CheckID",
+				"delete_check orders-legacy@rds",
+			},
+		},
+	}
+
+	e := &Engine{
+		DefaultNode: "rds",
+		Compare: func(existing, desired *config.Service) string {
+			switch {
+			case existing.CheckNode != desired.CheckNode:
+				return "CheckNode"
+			case existing.CheckID != desired.CheckID:
+				return "CheckID"
+			}
+			return compareAddress(existing, desired)
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			desired := test.desired
+			if desired == nil {
+				desired = config.Services{}
+			}
+
+			got := make([]string, 0)
+			for _, op := range e.Plan(desired, test.existing, test.orphans) {
+				got = append(got, describe(op))
+			}
+
+			configtest.Equal(t, got, test.want)
+		})
+	}
+}
+
+func BenchmarkPlan(b *testing.B) {
+	desired, existing := benchmarkCatalogs(10000)
+	e := &Engine{DefaultNode: "rds", Compare: compareAddress}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Plan(desired, existing, nil)
+	}
+}
+
+// sliceScanPlan reproduces the diffing of the writer before the engine, which tracked the seen and
+// found IDs in slices. It is only kept to compare BenchmarkPlan with BenchmarkPlanSliceScan
+func sliceScanPlan(desired, existing config.Services) int {
+	seen := &seenCatalog{Services: existing.IDs(), Checks: make([]string, 0, len(existing))}
+	for _, id := range seen.Services {
+		seen.Checks = append(seen.Checks, existing[id].CheckID)
+	}
+
+	found := &seenCatalog{Services: make([]string, 0), Checks: make([]string, 0)}
+	ops := 0
+
+	for _, id := range desired.IDs() {
+		service := desired[id]
+
+		if !stringInSlice(service.ServiceID, seen.Services) || compareAddress(existing[id], service) != "" {
+			ops++
+		}
+		found.Services = append(found.Services, service.ServiceID)
+
+		if !stringInSlice(service.CheckID, seen.Checks) {
+			ops++
+		}
+		found.Checks = append(found.Checks, service.CheckID)
+	}
+
+	ops += len(getDifference(seen.Services, found.Services))
+	ops += len(getDifference(seen.Checks, found.Checks))
+
+	return ops
+}
+
+type seenCatalog struct {
+	Services []string
+	Checks   []string
+}
+
+func getDifference(slice1, slice2 []string) []string {
+	diff := make([]string, 0)
+
+	for _, s1 := range slice1 {
+		if !stringInSlice(s1, slice2) {
+			diff = append(diff, s1)
+		}
+	}
+
+	return diff
+}
+
+func stringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+func BenchmarkPlanSliceScan(b *testing.B) {
+	desired, existing := benchmarkCatalogs(10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sliceScanPlan(desired, existing)
+	}
+}
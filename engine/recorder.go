@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/seatgeek/aws-dynamic-consul-catalog/audit"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/metrics"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// Observer is told the outcome of every operation of a sync
+type Observer interface {
+	Done(op *Operation, err error)
+}
+
+// Recorder is the Observer of a backend target. It logs, counts, audits and queues a notification
+// for every operation, and keeps the outcome of the last sync
+type Recorder struct {
+	// Target names the backend in metrics, audit records and notifications
+	Target   string
+	Audit    audit.Sink
+	Notifier *notify.Notifier
+
+	// SyncID and Trigger identify the current sync
+	SyncID  string
+	Trigger string
+
+	// Changes and Failures count the operations of the current sync
+	Changes  int
+	Failures int
+
+	// LastSync and LastSyncDuration are when the last sync started and how long it took
+	LastSync         time.Time
+	LastSyncDuration time.Duration
+
+	events []*notify.Event
+	logger *log.Entry
+}
+
+// Begin resets the recorder for a new sync
+func (r *Recorder) Begin(syncID, trigger string, logger *log.Entry) {
+	r.SyncID, r.Trigger = syncID, trigger
+	r.Changes, r.Failures = 0, 0
+	r.LastSync = time.Now()
+	r.logger = logger
+}
+
+// End records the duration of the sync and the number of services the source produced
+func (r *Recorder) End(services int) {
+	r.LastSyncDuration = time.Since(r.LastSync)
+
+	metrics.Services.WithLabelValues(r.Target).Set(float64(services))
+	metrics.SyncDuration.WithLabelValues(r.Target).Observe(r.LastSyncDuration.Seconds())
+}
+
+// Done logs, audits and tracks the outcome of an operation
+func (r *Recorder) Done(op *Operation, err error) {
+	if op.Type == Flush {
+		if err != nil {
+			r.track(op.Type, fmt.Errorf("could not flush the %s catalog: %s", r.Target, err))
+		}
+
+		return
+	}
+
+	record := &audit.Record{Operation: op.Type, Node: op.Node, Changed: op.Changed, Before: op.Before, After: op.After}
+
+	var eventType, message string
+	switch {
+	case op.Type == WriteService && op.Before == nil:
+		r.logger.Infof("Service %s doesn't exist in remote catalog, creating", op.ServiceID)
+		record.ServiceID, record.CheckID = op.ServiceID, op.CheckID
+		eventType, message = "create", fmt.Sprintf("Created service %s (%s:%d, %s)", op.ServiceID, op.After.ServiceAddress, op.After.ServicePort, op.After.CheckStatus)
+	case op.Type == WriteService:
+		r.logger.Infof("Service %s is not identical (%s), updating catalog", op.ServiceID, op.Changed)
+		record.ServiceID, record.CheckID = op.ServiceID, op.CheckID
+		eventType, message = "update", fmt.Sprintf("Updated service %s (%s:%d, %s)", op.ServiceID, op.After.ServiceAddress, op.After.ServicePort, op.After.CheckStatus)
+	case op.Type == DeleteService && op.Moved:
+		r.logger.Warnf("Service %s moved from node %s, deleting it from the old node", op.ServiceID, op.Node)
+		record.ServiceID = op.ServiceID
+		eventType, message = "delete", fmt.Sprintf("Deleted service %s from node %s", op.ServiceID, op.Node)
+	case op.Type == DeleteService:
+		r.logger.Warnf("Deleting service %s", op.ServiceID)
+		record.ServiceID = op.ServiceID
+		eventType, message = "delete", fmt.Sprintf("Deleted service %s", op.ServiceID)
+	case op.Type == DeleteCheck:
+		r.logger.Warnf("Deleting check %s", op.CheckID)
+		record.CheckID = op.CheckID
+		eventType, message = "delete-check", fmt.Sprintf("Deleted check %s", op.CheckID)
+	}
+
+	r.audit(record, err)
+	if r.track(op.Type, err) == nil {
+		id := op.ServiceID
+		if op.Type == DeleteCheck {
+			id = op.CheckID
+		}
+
+		r.Event(eventType, id, message)
+	}
+}
+
+// Event queues a notification, all events of a sync are sent as one digest
+func (r *Recorder) Event(eventType, service, message string) {
+	if !r.Notifier.Enabled() {
+		return
+	}
+
+	r.events = append(r.events, &notify.Event{
+		Type:    eventType,
+		Target:  r.Target,
+		Service: service,
+		Message: message,
+		Time:    time.Now().UTC(),
+	})
+}
+
+// Events returns the queued notifications and clears them
+func (r *Recorder) Events() []*notify.Event {
+	events := r.events
+	r.events = nil
+
+	return events
+}
+
+// track records the outcome of an operation, and returns its error
+func (r *Recorder) track(operation string, err error) error {
+	metrics.BackendOperations.WithLabelValues(r.Target, operation).Inc()
+
+	if err != nil {
+		metrics.BackendFailures.WithLabelValues(r.Target, operation).Inc()
+		r.logger.Error(err)
+		r.Failures++
+	} else {
+		r.Changes++
+	}
+
+	return err
+}
+
+// audit writes a record of a catalog mutation to the audit log
+func (r *Recorder) audit(record *audit.Record, err error) {
+	if r.Audit == nil {
+		return
+	}
+
+	record.Time = time.Now().UTC()
+	record.SyncID = r.SyncID
+	record.Trigger = r.Trigger
+	record.Target = r.Target
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if err := r.Audit.Write(record); err != nil {
+		log.WithField("worker", "audit").Errorf("Could not write audit record: %s", err)
+	}
+}
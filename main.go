@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"os"
 	"runtime/debug"
 	"time"
@@ -52,6 +51,162 @@ func main() {
 			EnvVar: "CONSUL_SERVICE_SUFFIX",
 			Value:  "",
 		},
+		cli.StringFlag{
+			Name:   "backend",
+			Usage:  "Where to write the service catalog (consul, file, prometheus, route53, kubernetes or nomad)",
+			EnvVar: "BACKEND",
+			Value:  "consul",
+		},
+		cli.StringFlag{
+			Name:   "file-path",
+			Usage:  "Path of the catalog file for the file and prometheus backends, use - for stdout",
+			EnvVar: "FILE_PATH",
+			Value:  "catalog.json",
+		},
+		cli.StringFlag{
+			Name:   "file-format",
+			Usage:  "Format of the catalog file for the file backend (json or yaml)",
+			EnvVar: "FILE_FORMAT",
+			Value:  "json",
+		},
+		cli.DurationFlag{
+			Name:   "file-poll-interval",
+			Usage:  "How often the file and prometheus backends check the catalog file for outside changes, 0 disables it (eg. 30s, 1h, 1h10m, 1d)",
+			EnvVar: "FILE_POLL_INTERVAL",
+			Value:  30 * time.Second,
+		},
+		cli.IntFlag{
+			Name:   "prometheus-exporter-port",
+			Usage:  "Port of the exporter to scrape for every instance with the prometheus backend (defaults to the service port)",
+			EnvVar: "PROMETHEUS_EXPORTER_PORT",
+		},
+		cli.StringFlag{
+			Name:   "route53-zone-id",
+			Usage:  "ID of the Route 53 hosted zone to write records in with the route53 backend",
+			EnvVar: "ROUTE53_ZONE_ID",
+		},
+		cli.StringFlag{
+			Name:   "route53-domain",
+			Usage:  "Domain the route53 backend creates <service>.<role>.<domain> records under",
+			EnvVar: "ROUTE53_DOMAIN",
+			Value:  "db.internal",
+		},
+		cli.StringFlag{
+			Name:   "route53-owner-id",
+			Usage:  "Owner written to the ownership TXT records, only records with this owner are changed or deleted",
+			EnvVar: "ROUTE53_OWNER_ID",
+			Value:  "aws-dynamic-consul-catalog",
+		},
+		cli.Int64Flag{
+			Name:   "route53-ttl",
+			Usage:  "TTL of the records written by the route53 backend",
+			EnvVar: "ROUTE53_TTL",
+			Value:  60,
+		},
+		cli.DurationFlag{
+			Name:   "route53-poll-interval",
+			Usage:  "How often the route53 backend reads the hosted zone for changes (eg. 30s, 1h, 1h10m, 1d)",
+			EnvVar: "ROUTE53_POLL_INTERVAL",
+			Value:  5 * time.Minute,
+		},
+		cli.StringFlag{
+			Name:   "kubernetes-kubeconfig",
+			Usage:  "Path of the kubeconfig for the kubernetes backend (defaults to the in-cluster configuration)",
+			EnvVar: "KUBERNETES_KUBECONFIG",
+		},
+		cli.StringFlag{
+			Name:   "kubernetes-namespace",
+			Usage:  "Namespace the kubernetes backend writes services in",
+			EnvVar: "KUBERNETES_NAMESPACE",
+			Value:  "databases",
+		},
+		cli.StringFlag{
+			Name:   "kubernetes-mode",
+			Usage:  "How the kubernetes backend exposes services (externalname or endpointslice)",
+			EnvVar: "KUBERNETES_MODE",
+			Value:  "externalname",
+		},
+		cli.StringFlag{
+			Name:   "kubernetes-owner-id",
+			Usage:  "Owner label value of the objects written by the kubernetes backend, only objects with this owner are changed or pruned",
+			EnvVar: "KUBERNETES_OWNER_ID",
+			Value:  "aws-dynamic-consul-catalog",
+		},
+		cli.DurationFlag{
+			Name:   "kubernetes-poll-interval",
+			Usage:  "How often the kubernetes backend lists services for changes (eg. 30s, 1h, 1h10m, 1d)",
+			EnvVar: "KUBERNETES_POLL_INTERVAL",
+			Value:  5 * time.Minute,
+		},
+		cli.StringFlag{
+			Name:   "nomad-addr",
+			Usage:  "Address of the Nomad agent for the nomad backend",
+			EnvVar: "NOMAD_ADDR",
+			Value:  "http://127.0.0.1:4646",
+		},
+		cli.StringFlag{
+			Name:   "nomad-token",
+			Usage:  "Nomad ACL token for the nomad backend",
+			EnvVar: "NOMAD_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "nomad-region",
+			Usage:  "Nomad region the nomad backend registers its job in (defaults to the agent region)",
+			EnvVar: "NOMAD_REGION",
+		},
+		cli.StringFlag{
+			Name:   "nomad-namespace",
+			Usage:  "Nomad namespace the nomad backend registers its job and services in",
+			EnvVar: "NOMAD_NAMESPACE",
+		},
+		cli.StringFlag{
+			Name:   "nomad-job-id",
+			Usage:  "ID of the Nomad job holding the services written by the nomad backend, it must not be used by any other job",
+			EnvVar: "NOMAD_JOB_ID",
+			Value:  "aws-dynamic-consul-catalog",
+		},
+		cli.StringSliceFlag{
+			Name:   "nomad-datacenter",
+			Usage:  "Datacenter the allocations of the nomad backend job can be placed in (defaults to all) - Can be used multiple times",
+			EnvVar: "NOMAD_DATACENTER",
+		},
+		cli.StringFlag{
+			Name:   "nomad-task-image",
+			Usage:  "Docker image of the placeholder task keeping the allocation of every service running with the nomad backend",
+			EnvVar: "NOMAD_TASK_IMAGE",
+			Value:  "registry.k8s.io/pause:3.10",
+		},
+		cli.DurationFlag{
+			Name:   "nomad-poll-interval",
+			Usage:  "How often the nomad backend reads its job for changes (eg. 30s, 1h, 1h10m, 1d)",
+			EnvVar: "NOMAD_POLL_INTERVAL",
+			Value:  5 * time.Minute,
+		},
+		cli.StringSliceFlag{
+			Name:   "consul-datacenter",
+			Usage:  "Consul datacenter to read and write the catalog in (defaults to the agent datacenter) - Can be used multiple times to sync into multiple datacenters",
+			EnvVar: "CONSUL_DATACENTER",
+		},
+		cli.StringFlag{
+			Name:   "consul-namespace",
+			Usage:  "Consul Enterprise namespace to read and write the catalog in",
+			EnvVar: "CONSUL_NAMESPACE",
+		},
+		cli.StringFlag{
+			Name:   "consul-partition",
+			Usage:  "Consul Enterprise admin partition to read and write the catalog in",
+			EnvVar: "CONSUL_PARTITION",
+		},
+		cli.StringFlag{
+			Name:   "consul-token-file",
+			Usage:  "File containing the Consul ACL token, re-read when it changes",
+			EnvVar: "CONSUL_TOKEN_FILE",
+		},
+		cli.BoolFlag{
+			Name:   "consul-stale-reads",
+			Usage:  "Read the Consul catalog from any server instead of only the leader",
+			EnvVar: "CONSUL_STALE_READS",
+		},
 		cli.StringFlag{
 			Name:   "on-duplicate",
 			Usage:  "What to do if duplicate services/check are found in RDS (e.g. multiple instances with same DB name or consul_service_name tag - and same RDS Replication Role",
@@ -64,6 +219,43 @@ func main() {
 			EnvVar: "CHECK_INTERVAL",
 			Value:  60 * time.Second,
 		},
+		cli.StringFlag{
+			Name:   "metrics-addr",
+			Usage:  "Address to serve Prometheus metrics on (e.g. :9090), disabled when empty",
+			EnvVar: "METRICS_ADDR",
+		},
+		cli.StringFlag{
+			Name:   "audit-log",
+			Usage:  "Path of a file to append a JSON line to for every catalog mutation",
+			EnvVar: "AUDIT_LOG",
+		},
+		cli.StringSliceFlag{
+			Name:   "notify-webhook-url",
+			Usage:  "URL to POST a JSON array of catalog change events to after every pass - Can be used multiple times",
+			EnvVar: "NOTIFY_WEBHOOK_URL",
+		},
+		cli.StringSliceFlag{
+			Name:   "notify-slack-url",
+			Usage:  "Slack incoming webhook URL to send a digest of catalog changes to after every pass - Can be used multiple times",
+			EnvVar: "NOTIFY_SLACK_URL",
+		},
+		cli.StringFlag{
+			Name:   "notify-template-url",
+			Usage:  "URL to POST catalog change events rendered through --notify-template to after every pass",
+			EnvVar: "NOTIFY_TEMPLATE_URL",
+		},
+		cli.StringFlag{
+			Name:   "notify-template",
+			Usage:  "Go template rendering the list of events for --notify-template-url",
+			EnvVar: "NOTIFY_TEMPLATE",
+			Value:  "{{range .}}[{{.Target}}] {{.Type}}: {{.Message}}\n{{end}}",
+		},
+		cli.StringFlag{
+			Name:   "notify-template-content-type",
+			Usage:  "Content type of the body sent to --notify-template-url",
+			EnvVar: "NOTIFY_TEMPLATE_CONTENT_TYPE",
+			Value:  "text/plain",
+		},
 		cli.StringFlag{
 			Name:   "log-level",
 			Usage:  "Define log level",
@@ -77,40 +269,160 @@ func main() {
 			Value:  "text",
 		},
 	}
+
+	rdsFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "consul-master-tag",
+			Usage:  "The Consul service tag for master instances",
+			Value:  "master",
+			EnvVar: "CONSUL_MASTER_TAG",
+		},
+		cli.StringFlag{
+			Name:   "consul-replica-tag",
+			Usage:  "The Consul service tag for replica instances",
+			Value:  "replica",
+			EnvVar: "CONSUL_REPLICA_TAG",
+		},
+		cli.StringFlag{
+			Name:   "consul-remote-replica-tag",
+			Usage:  "The extra Consul service tag for replicas of an instance in another region or account",
+			Value:  "remote-replica",
+			EnvVar: "CONSUL_REMOTE_REPLICA_TAG",
+		},
+		cli.StringFlag{
+			Name:   "remote-replicas",
+			Usage:  "What to do with replicas of an instance in another region or account (register or exclude)",
+			Value:  "register",
+			EnvVar: "REMOTE_REPLICAS",
+		},
+		cli.StringFlag{
+			Name:   "consul-node-name",
+			Usage:  "Consul catalog node name",
+			Value:  "rds",
+			EnvVar: "CONSUL_NODE_NAME",
+		},
+		cli.StringFlag{
+			Name:   "failover-webhook-url",
+			Usage:  "URL to POST a JSON event to when an instance changes availability zone or replication role",
+			EnvVar: "FAILOVER_WEBHOOK_URL",
+		},
+		cli.BoolFlag{
+			Name:   "node-per-instance",
+			Usage:  "Register every RDS instance on its own Consul node, named <consul-node-name>-<instance identifier>",
+			EnvVar: "NODE_PER_INSTANCE",
+		},
+		cli.BoolFlag{
+			Name:   "node-per-az",
+			Usage:  "Register RDS instances on a Consul node per availability zone, named <consul-node-name>-<availability zone>",
+			EnvVar: "NODE_PER_AZ",
+		},
+		cli.StringFlag{
+			Name:   "instance-id",
+			Usage:  "Identifier of this copy of the daemon, stamped on every service it writes. Only services with this identifier are updated or deleted (defaults to the consul node name)",
+			EnvVar: "INSTANCE_ID",
+		},
+		cli.BoolFlag{
+			Name:   "once",
+			Usage:  "Do a single sync pass and exit, with exit code 0 if nothing changed, 2 if changes were made and 1 on errors",
+			EnvVar: "ONCE",
+		},
+		cli.DurationFlag{
+			Name:   "once-timeout",
+			Usage:  "With --once, how long to wait for the catalog of every backend to load before exiting with exit code 1",
+			EnvVar: "ONCE_TIMEOUT",
+			Value:  2 * time.Minute,
+		},
+		cli.DurationFlag{
+			Name:   "rds-tag-cache-time",
+			Usage:  "The time RDS tags should be cached (eg. 30s, 1h, 1h10m, 1d)",
+			EnvVar: "RDS_TAG_CACHE_TIME",
+			Value:  30 * time.Minute,
+		},
+		cli.BoolFlag{
+			Name:   "vault-sync",
+			Usage:  "Keep Vault database secrets engine connections in sync with the RDS instances",
+			EnvVar: "VAULT_SYNC",
+		},
+		cli.StringFlag{
+			Name:   "vault-mount",
+			Usage:  "Path the Vault database secrets engine is mounted at",
+			Value:  "database",
+			EnvVar: "VAULT_MOUNT",
+		},
+		cli.StringFlag{
+			Name:   "vault-connection-prefix",
+			Usage:  "Prefix of the Vault connection names, only connections with this prefix and our instance ID are updated or removed",
+			Value:  "rds-",
+			EnvVar: "VAULT_CONNECTION_PREFIX",
+		},
+		cli.StringSliceFlag{
+			Name:   "vault-plugin",
+			Usage:  "Vault database plugin to use for an RDS engine (e.g. mysql=mysql-database-plugin) - Can be used multiple times",
+			EnvVar: "VAULT_PLUGIN",
+		},
+		cli.StringSliceFlag{
+			Name:   "vault-connection-url",
+			Usage:  "Connection URL template for a Vault database plugin (e.g. mysql-database-plugin={{username}}:{{password}}@tcp([[.Address]]:[[.Port]])/) - Can be used multiple times",
+			EnvVar: "VAULT_CONNECTION_URL",
+		},
+		cli.StringFlag{
+			Name:   "vault-allowed-roles",
+			Usage:  "Comma separated Vault roles allowed to use a connection, unless the instance has a vault_allowed_roles tag",
+			EnvVar: "VAULT_ALLOWED_ROLES",
+		},
+		cli.StringFlag{
+			Name:   "vault-username",
+			Usage:  "Username of the Vault connections (defaults to the instance master username)",
+			EnvVar: "VAULT_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "vault-password-file",
+			Usage:  "File containing the password of the Vault connections",
+			EnvVar: "VAULT_PASSWORD_FILE",
+		},
+		cli.BoolFlag{
+			Name:   "vault-verify-connection",
+			Usage:  "Let Vault verify a connection when writing it",
+			EnvVar: "VAULT_VERIFY_CONNECTION",
+		},
+	}
+
 	app.Commands = []cli.Command{
 		{
-			Name:  "rds",
-			Usage: "Run the script",
-			Flags: []cli.Flag{
-				cli.StringFlag{
-					Name:   "consul-master-tag",
-					Usage:  "The Consul service tag for master instances",
-					Value:  "master",
-					EnvVar: "CONSUL_MASTER_TAG",
-				},
-				cli.StringFlag{
-					Name:   "consul-replica-tag",
-					Usage:  "The Consul service tag for replica instances",
-					Value:  "replica",
-					EnvVar: "CONSUL_REPLICA_TAG",
-				},
-				cli.StringFlag{
-					Name:   "consul-node-name",
-					Usage:  "Consul catalog node name",
-					Value:  "rds",
-					EnvVar: "CONSUL_NODE_NAME",
-				},
-				cli.DurationFlag{
-					Name:   "rds-tag-cache-time",
-					Usage:  "The time RDS tags should be cached (eg. 30s, 1h, 1h10m, 1d)",
-					EnvVar: "RDS_TAG_CACHE_TIME",
-					Value:  30 * time.Minute,
-				},
-			},
+			Name:    "rds",
+			Aliases: []string{"sync"},
+			Usage:   "Run the script, or a single pass with --once",
+			Flags:   rdsFlags,
 			Action: func(c *cli.Context) error {
 				app := rds.New(c)
+
+				if c.Bool("once") {
+					os.Exit(app.RunOnce())
+				}
+
 				app.Run()
 
+				return nil
+			},
+		},
+		{
+			Name:  "export",
+			Usage: "Print the discovered RDS instances, their service names and IDs, and why they are excluded",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:   "format",
+					Usage:  "Output format (table, json or csv)",
+					Value:  "table",
+					EnvVar: "EXPORT_FORMAT",
+				},
+			}, rdsFlags...),
+			Action: func(c *cli.Context) error {
+				app := rds.NewExport(c)
+
+				if err := app.Export(os.Stdout, c.String("format")); err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
 				return nil
 			},
 		},
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const namespace = "aws_dynamic_consul_catalog"
+
+var (
+	// BackendOperations counts the catalog mutations sent to each backend target
+	BackendOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_operations_total",
+		Help:      "Catalog mutations sent to a backend target",
+	}, []string{"target", "operation"})
+
+	// BackendFailures counts the catalog mutations a backend target failed to apply
+	BackendFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_failures_total",
+		Help:      "Catalog mutations a backend target failed to apply",
+	}, []string{"target", "operation"})
+
+	// SyncDuration tracks how long a full write pass takes for each backend target
+	SyncDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_duration_seconds",
+		Help:      "Time spent writing a full catalog pass to a backend target",
+	}, []string{"target"})
+
+	// Failovers counts the availability zone and replication role changes of instances
+	Failovers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failovers_total",
+		Help:      "Availability zone (failover) and replication role (role-change) changes of instances",
+	}, []string{"type"})
+
+	// ExcludedInstances tracks the number of RDS instances the filters excluded in the last pass, by reason
+	ExcludedInstances = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "excluded_instances",
+		Help:      "RDS instances excluded by the filters in the last pass",
+	}, []string{"reason"})
+
+	// SkippedServices tracks the number of services not written to each backend target in the last pass, by reason
+	SkippedServices = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "skipped_services",
+		Help:      "Services not written to a backend target in the last pass",
+	}, []string{"target", "reason"})
+
+	// Services tracks the number of services written to each backend target in the last pass
+	Services = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "services",
+		Help:      "Services written to a backend target in the last pass",
+	}, []string{"target"})
+)
+
+var mux = http.NewServeMux()
+
+// Handle registers an extra handler served next to the metrics
+func Handle(pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+}
+
+// Serve exposes the metrics on /metrics at the given address
+func Serve(addr string) {
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.Infof("Serving metrics on %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("Could not serve metrics: %s", err)
+	}
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Event is a notable change made or seen while writing the catalog
+type Event struct {
+	Type    string            `json:"type"`
+	Target  string            `json:"target,omitempty"`
+	Service string            `json:"service,omitempty"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+// Sink delivers events
+type Sink interface {
+	Send(events []*Event) error
+}
+
+// Notifier sends events to every configured sink
+type Notifier struct {
+	sinks []Sink
+}
+
+// New ...
+func New(sinks ...Sink) *Notifier {
+	return &Notifier{sinks: sinks}
+}
+
+// Enabled returns true if there is at least one sink
+func (n *Notifier) Enabled() bool {
+	return n != nil && len(n.sinks) > 0
+}
+
+// Send delivers the events to every sink as a single batch, errors are logged
+func (n *Notifier) Send(events []*Event) {
+	if !n.Enabled() || len(events) == 0 {
+		return
+	}
+
+	for _, sink := range n.sinks {
+		if err := sink.Send(events); err != nil {
+			log.WithField("worker", "notifier").Error(err)
+		}
+	}
+}
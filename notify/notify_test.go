@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request is what the receiver got
+type request struct {
+	contentType string
+	body        string
+}
+
+// receiver returns a server answering with status, and the requests it received
+func receiver(t *testing.T, status int) (*httptest.Server, *[]request) {
+	requests := make([]request, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			t.Errorf("got method %s, want POST", req.Method)
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		requests = append(requests, request{contentType: req.Header.Get("Content-Type"), body: string(body)})
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func testEvents() []*Event {
+	at := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	return []*Event{
+		{Type: "create", Target: "consul", Service: "orders", Message: "Created service orders", Time: at},
+		{Type: "failover", Target: "consul", Service: "payments", Message: "payments failed over", Fields: map[string]string{"from": "db-1"}, Time: at},
+	}
+}
+
+func TestWebhookBody(t *testing.T) {
+	server, requests := receiver(t, http.StatusOK)
+
+	if err := NewWebhook(server.URL).Send(testEvents()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*requests))
+	}
+
+	got := (*requests)[0]
+	if got.contentType != "application/json" {
+		t.Errorf("got content type %s", got.contentType)
+	}
+
+	want := `[{"type":"create","target":"consul","service":"orders","message":"Created service orders","time":"2024-08-01T12:00:00Z"},` +
+		`{"type":"failover","target":"consul","service":"payments","message":"payments failed over","fields":{"from":"db-1"},"time":"2024-08-01T12:00:00Z"}]`
+	if got.body != want {
+		t.Errorf("got body\n  %s\nwant\n  %s", got.body, want)
+	}
+}
+
+func TestSlackDigest(t *testing.T) {
+	server, requests := receiver(t, http.StatusOK)
+	slack := NewSlack(server.URL)
+
+	if err := slack.Send(testEvents()); err != nil {
+		t.Fatal(err)
+	}
+	if err := slack.Send(testEvents()[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"*aws-dynamic-consul-catalog* 2 changes (consul)\n• `create` Created service orders\n• `failover` payments failed over",
+		"*aws-dynamic-consul-catalog* (consul)\n• `create` Created service orders",
+	}
+
+	if len(*requests) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(*requests), len(want))
+	}
+
+	for i, got := range *requests {
+		message := map[string]string{}
+		if err := json.Unmarshal([]byte(got.body), &message); err != nil {
+			t.Fatal(err)
+		}
+
+		if message["text"] != want[i] {
+			t.Errorf("got text\n  %q\nwant\n  %q", message["text"], want[i])
+		}
+	}
+}
+
+func TestSafetyValveEvent(t *testing.T) {
+	server, requests := receiver(t, http.StatusOK)
+
+	event := &Event{Type: "safety-valve", Target: "consul", Service: "orders", Message: "Aborted the pass on duplicate service ID orders, see --on-duplicate", Time: time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)}
+	n := New(NewWebhook(server.URL), NewSlack(server.URL))
+	n.Send([]*Event{event})
+
+	if len(*requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(*requests))
+	}
+
+	want := `[{"type":"safety-valve","target":"consul","service":"orders","message":"Aborted the pass on duplicate service ID orders, see --on-duplicate","time":"2024-08-01T12:00:00Z"}]`
+	if got := (*requests)[0].body; got != want {
+		t.Errorf("got webhook body\n  %s\nwant\n  %s", got, want)
+	}
+
+	message := map[string]string{}
+	if err := json.Unmarshal([]byte((*requests)[1].body), &message); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "*aws-dynamic-consul-catalog* (consul)\n• `safety-valve` Aborted the pass on duplicate service ID orders, see --on-duplicate"; message["text"] != want {
+		t.Errorf("got slack text %q, want %q", message["text"], want)
+	}
+}
+
+func TestTemplateRendering(t *testing.T) {
+	server, requests := receiver(t, http.StatusNoContent)
+
+	tmpl, err := NewTemplate(server.URL, "text/plain", `{{range .}}{{.Type}} {{.Service}}: {{.Message}}{{with .Fields}} from={{.from}}{{end}}
+{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tmpl.Send(testEvents()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := (*requests)[0]
+	if got.contentType != "text/plain" {
+		t.Errorf("got content type %s", got.contentType)
+	}
+
+	want := "create orders: Created service orders\nfailover payments: payments failed over from=db-1\n"
+	if got.body != want {
+		t.Errorf("got body %q, want %q", got.body, want)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	if _, err := NewTemplate("http://localhost", "text/plain", "{{range .}"); err == nil {
+		t.Error("parsed an invalid template")
+	}
+
+	server, requests := receiver(t, http.StatusOK)
+
+	tmpl, err := NewTemplate(server.URL, "text/plain", "{{.Missing}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tmpl.Send(testEvents()); err == nil || !strings.Contains(err.Error(), "could not render notification template") {
+		t.Errorf("got error %v", err)
+	}
+
+	if len(*requests) != 0 {
+		t.Errorf("sent %d requests for a template that did not render", len(*requests))
+	}
+}
+
+func TestNon2xxIsAnError(t *testing.T) {
+	server, _ := receiver(t, http.StatusInternalServerError)
+
+	tmpl, err := NewTemplate(server.URL, "text/plain", "{{len .}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, sink := range map[string]Sink{"webhook": NewWebhook(server.URL), "slack": NewSlack(server.URL), "template": tmpl} {
+		err := sink.Send(testEvents())
+		if err == nil || !strings.Contains(err.Error(), "unexpected status 500") {
+			t.Errorf("%s: got error %v", name, err)
+		}
+	}
+}
+
+// failing is a sink that always fails
+type failing struct {
+	sent int
+}
+
+func (f *failing) Send(events []*Event) error {
+	f.sent++
+	return io.ErrUnexpectedEOF
+}
+
+func TestNotifierSendsToEverySink(t *testing.T) {
+	server, requests := receiver(t, http.StatusOK)
+	broken := &failing{}
+
+	n := New(broken, NewWebhook(server.URL))
+	if !n.Enabled() {
+		t.Fatal("notifier with sinks is not enabled")
+	}
+
+	// nothing to send
+	n.Send(nil)
+	if broken.sent != 0 || len(*requests) != 0 {
+		t.Error("sent an empty batch")
+	}
+
+	// a failing sink does not stop the others
+	n.Send(testEvents())
+	if broken.sent != 1 || len(*requests) != 1 {
+		t.Errorf("got %d sends to the failing sink and %d requests", broken.sent, len(*requests))
+	}
+
+	var disabled *Notifier
+	if disabled.Enabled() || New().Enabled() {
+		t.Error("notifier without sinks is enabled")
+	}
+}
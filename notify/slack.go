@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Slack posts events as a single digest message to a Slack incoming webhook
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlack ...
+func NewSlack(url string) *Slack {
+	return &Slack{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send ...
+func (s *Slack) Send(events []*Event) error {
+	lines := make([]string, 0, len(events)+1)
+
+	if len(events) == 1 {
+		lines = append(lines, fmt.Sprintf("*aws-dynamic-consul-catalog* (%s)", events[0].Target))
+	} else {
+		lines = append(lines, fmt.Sprintf("*aws-dynamic-consul-catalog* %d changes (%s)", len(events), events[0].Target))
+	}
+
+	for _, event := range events {
+		lines = append(lines, fmt.Sprintf("• `%s` %s", event.Type, event.Message))
+	}
+
+	body, err := json.Marshal(map[string]string{"text": strings.Join(lines, "\n")})
+	if err != nil {
+		return fmt.Errorf("could not encode slack message: %s", err)
+	}
+
+	return post(s.client, s.url, "application/json", body)
+}
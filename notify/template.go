@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// Template posts events rendered through a Go template to a URL
+type Template struct {
+	url         string
+	contentType string
+	template    *template.Template
+	client      *http.Client
+}
+
+// NewTemplate ...
+func NewTemplate(url, contentType, body string) (*Template, error) {
+	tmpl, err := template.New("notification").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification template: %s", err)
+	}
+
+	return &Template{
+		url:         url,
+		contentType: contentType,
+		template:    tmpl,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Send ...
+func (t *Template) Send(events []*Event) error {
+	var body bytes.Buffer
+	if err := t.template.Execute(&body, events); err != nil {
+		return fmt.Errorf("could not render notification template: %s", err)
+	}
+
+	return post(t.client, t.url, t.contentType, body.Bytes())
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook posts events as a JSON array to a URL
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook ...
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send ...
+func (w *Webhook) Send(events []*Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("could not encode webhook body: %s", err)
+	}
+
+	return post(w.client, w.url, "application/json", body)
+}
+
+// post sends a body to a URL and expects a 2xx response
+func post(client *http.Client, url, contentType string, body []byte) error {
+	resp, err := client.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not send notification to %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("could not send notification to %s: unexpected status %s", url, resp.Status)
+	}
+
+	return nil
+}
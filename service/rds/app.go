@@ -1,15 +1,27 @@
 package rds
 
 import (
+	"fmt"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/rds"
 	observer "github.com/imkira/go-observer"
 	cache "github.com/patrickmn/go-cache"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/audit"
 	cc "github.com/seatgeek/aws-dynamic-consul-catalog/backend/consul"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/backend/file"
+	k8s "github.com/seatgeek/aws-dynamic-consul-catalog/backend/kubernetes"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/backend/nomad"
+	prom "github.com/seatgeek/aws-dynamic-consul-catalog/backend/prometheus"
+	r53 "github.com/seatgeek/aws-dynamic-consul-catalog/backend/route53"
 	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/engine"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/metrics"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/notify"
 	gelf "github.com/seatgeek/logrus-gelf-formatter"
 	log "github.com/sirupsen/logrus"
 	cli "gopkg.in/urfave/cli.v1"
@@ -17,30 +29,92 @@ import (
 
 // RDS ...
 type RDS struct {
-	rds              *rds.RDS
-	backend          config.Backend
-	logger           log.Entry
-	instanceFilters  config.Filters
-	tagFilters       config.Filters
-	tagCache         *cache.Cache
-	checkInterval    time.Duration
-	quitCh           chan int
-	onDuplicate      string
-	servicePrefix    string
-	serviceSuffix    string
-	consulNodeName   string
-	consulMasterTag  string
-	consulReplicaTag string
+	rds                    *rds.RDS
+	targets                []*target
+	vault                  *vaultSink
+	topology               map[string]*topology
+	topologyLock           sync.Mutex
+	failoverWebhook        *notify.Webhook
+	notifier               *notify.Notifier
+	auditSink              audit.Sink
+	sending                sync.WaitGroup
+	rejected               []*rejection
+	rejectedLock           sync.Mutex
+	logger                 log.Entry
+	instanceFilters        config.Filters
+	tagFilters             config.Filters
+	tagCache               *cache.Cache
+	tagCacheTime           time.Duration
+	allInstances           observer.Property
+	filteredInstances      observer.Property
+	checkInterval          time.Duration
+	onceTimeout            time.Duration
+	quitCh                 chan int
+	onDuplicate            string
+	servicePrefix          string
+	serviceSuffix          string
+	consulNodeName         string
+	instanceID             string
+	nodePerInstance        bool
+	nodePerAZ              bool
+	consulMasterTag        string
+	consulReplicaTag       string
+	consulRemoteReplicaTag string
+	remoteReplicas         string
+	metricsAddr            string
+}
+
+// target is a single backend the catalog is written to, with its own view of the remote catalog
+type target struct {
+	name    string
+	backend config.Backend
+	state   *config.CatalogState
+
+	// recorder logs, counts, audits and notifies the backend operations of a pass
+	recorder *engine.Recorder
+
+	// rejected are the services not written in the current pass
+	rejected []*rejection
 }
 
 // New ...
 func New(c *cli.Context) *RDS {
+	r := newRDS(c)
+	r.targets = newTargets(c)
+	r.vault = newVaultSink(c)
+	r.notifier = newNotifier(c)
+	r.auditSink = newAuditSink(c)
+
+	for _, t := range r.targets {
+		t.recorder = &engine.Recorder{Target: t.name, Audit: r.auditSink, Notifier: r.notifier}
+	}
+
+	return r
+}
+
+// NewExport creates an app that only reads and filters RDS instances, without any backend
+func NewExport(c *cli.Context) *RDS {
+	return newRDS(c)
+}
+
+// newRDS creates the app with the RDS client, filters and service naming configured
+func newRDS(c *cli.Context) *RDS {
 	logLevel, err := log.ParseLevel(strings.ToUpper(c.GlobalString("log-level")))
 	if err != nil {
 		log.Fatalf("%s (%s)", err, c.GlobalString("log-level"))
 	}
 	log.SetLevel(logLevel)
 
+	if c.Bool("node-per-instance") && c.Bool("node-per-az") {
+		log.Fatal("node-per-instance and node-per-az can not be used together")
+	}
+
+	switch remoteReplicas := strings.ToLower(c.String("remote-replicas")); remoteReplicas {
+	case "register", "exclude":
+	default:
+		log.Fatalf("remote-replicas value %s is not a valid option (register or exclude)", remoteReplicas)
+	}
+
 	logFormat := strings.ToLower(c.GlobalString("log-format"))
 	switch logFormat {
 	case "json":
@@ -51,35 +125,282 @@ func New(c *cli.Context) *RDS {
 		log.Fatalf("log-format value %s is not a valid option (json or text)", logFormat)
 	}
 
+	var failoverWebhook *notify.Webhook
+	if url := c.String("failover-webhook-url"); url != "" {
+		failoverWebhook = notify.NewWebhook(url)
+	}
+
 	return &RDS{
-		rds: rds.New(session.Must(session.NewSession())),
-		backend:          cc.NewBackend(),
-		instanceFilters:  config.ProcessFilters(c.GlobalStringSlice("instance-filter")),
-		tagFilters:       config.ProcessFilters(c.GlobalStringSlice("tag-filter")),
-		tagCache:         cache.New(c.Duration("rds-tag-cache-time"), 10*time.Minute),
-		checkInterval:    c.GlobalDuration("check-interval"),
-		quitCh:           make(chan int),
-		onDuplicate:      c.GlobalString("on-duplicate"),
-		servicePrefix:    c.GlobalString("consul-service-prefix"),
-		serviceSuffix:    c.GlobalString("consul-service-suffix"),
-		consulNodeName:   c.String("consul-node-name"),
-		consulMasterTag:  c.String("consul-master-tag"),
-		consulReplicaTag: c.String("consul-replica-tag"),
+		rds:                    rds.New(session.Must(session.NewSession())),
+		topology:               make(map[string]*topology),
+		failoverWebhook:        failoverWebhook,
+		instanceFilters:        config.ProcessFilters(c.GlobalStringSlice("instance-filter")),
+		tagFilters:             config.ProcessFilters(c.GlobalStringSlice("tag-filter")),
+		tagCache:               cache.New(c.Duration("rds-tag-cache-time"), 10*time.Minute),
+		tagCacheTime:           c.Duration("rds-tag-cache-time"),
+		checkInterval:          c.GlobalDuration("check-interval"),
+		onceTimeout:            c.Duration("once-timeout"),
+		quitCh:                 make(chan int),
+		onDuplicate:            c.GlobalString("on-duplicate"),
+		servicePrefix:          c.GlobalString("consul-service-prefix"),
+		serviceSuffix:          c.GlobalString("consul-service-suffix"),
+		consulNodeName:         c.String("consul-node-name"),
+		instanceID:             instanceID(c),
+		consulMasterTag:        c.String("consul-master-tag"),
+		consulReplicaTag:       c.String("consul-replica-tag"),
+		consulRemoteReplicaTag: c.String("consul-remote-replica-tag"),
+		remoteReplicas:         strings.ToLower(c.String("remote-replicas")),
+		metricsAddr:            c.GlobalString("metrics-addr"),
+	}
+}
+
+// newNotifier creates the notification sinks for catalog changes
+func newNotifier(c *cli.Context) *notify.Notifier {
+	sinks := make([]notify.Sink, 0)
+
+	for _, url := range c.GlobalStringSlice("notify-webhook-url") {
+		sinks = append(sinks, notify.NewWebhook(url))
+	}
+
+	for _, url := range c.GlobalStringSlice("notify-slack-url") {
+		sinks = append(sinks, notify.NewSlack(url))
 	}
+
+	if url := c.GlobalString("notify-template-url"); url != "" {
+		sink, err := notify.NewTemplate(url, c.GlobalString("notify-template-content-type"), c.GlobalString("notify-template"))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	return notify.New(sinks...)
+}
+
+// newAuditSink opens the audit log, if configured
+func newAuditSink(c *cli.Context) audit.Sink {
+	path := c.GlobalString("audit-log")
+	if path == "" {
+		return nil
+	}
+
+	sink, err := audit.NewFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return sink
+}
+
+// instanceID returns the identifier of this copy of the daemon, stamped on every service it writes
+func instanceID(c *cli.Context) string {
+	if id := c.String("instance-id"); id != "" {
+		return id
+	}
+
+	return c.String("consul-node-name")
+}
+
+// newTargets creates the backend targets the catalog is written to
+func newTargets(c *cli.Context) []*target {
+	switch backend := strings.ToLower(c.GlobalString("backend")); backend {
+	case "consul":
+		return newConsulTargets(c)
+	case "file":
+		return []*target{
+			{
+				name:    "file",
+				backend: file.NewBackend(c.GlobalString("file-path"), strings.ToLower(c.GlobalString("file-format")), c.GlobalDuration("file-poll-interval")),
+				state:   config.NewCatalogState(),
+			},
+		}
+	case "prometheus":
+		return []*target{
+			{
+				name: "prometheus",
+				backend: prom.NewBackend(prom.Config{
+					Path:         c.GlobalString("file-path"),
+					ExporterPort: c.GlobalInt("prometheus-exporter-port"),
+					MasterTag:    c.String("consul-master-tag"),
+					ReplicaTag:   c.String("consul-replica-tag"),
+					PollInterval: c.GlobalDuration("file-poll-interval"),
+				}),
+				state: config.NewCatalogState(),
+			},
+		}
+	case "route53":
+		return []*target{
+			{
+				name: "route53",
+				backend: r53.NewBackend(r53.Config{
+					ZoneID:       c.GlobalString("route53-zone-id"),
+					Domain:       c.GlobalString("route53-domain"),
+					OwnerID:      c.GlobalString("route53-owner-id"),
+					TTL:          c.GlobalInt64("route53-ttl"),
+					PollInterval: c.GlobalDuration("route53-poll-interval"),
+					MasterTag:    c.String("consul-master-tag"),
+					ReplicaTag:   c.String("consul-replica-tag"),
+				}),
+				state: config.NewCatalogState(),
+			},
+		}
+	case "kubernetes":
+		return []*target{
+			{
+				name: "kubernetes",
+				backend: k8s.NewBackend(k8s.Config{
+					Kubeconfig:   c.GlobalString("kubernetes-kubeconfig"),
+					Namespace:    c.GlobalString("kubernetes-namespace"),
+					Mode:         strings.ToLower(c.GlobalString("kubernetes-mode")),
+					OwnerID:      c.GlobalString("kubernetes-owner-id"),
+					PollInterval: c.GlobalDuration("kubernetes-poll-interval"),
+				}),
+				state: config.NewCatalogState(),
+			},
+		}
+	case "nomad":
+		datacenters := c.GlobalStringSlice("nomad-datacenter")
+		if len(datacenters) == 0 {
+			datacenters = []string{"*"}
+		}
+
+		return []*target{
+			{
+				name: "nomad",
+				backend: nomad.NewBackend(nomad.Config{
+					Address:      c.GlobalString("nomad-addr"),
+					Token:        c.GlobalString("nomad-token"),
+					Region:       c.GlobalString("nomad-region"),
+					Namespace:    c.GlobalString("nomad-namespace"),
+					JobID:        c.GlobalString("nomad-job-id"),
+					Datacenters:  datacenters,
+					Image:        c.GlobalString("nomad-task-image"),
+					PollInterval: c.GlobalDuration("nomad-poll-interval"),
+				}),
+				state: config.NewCatalogState(),
+			},
+		}
+	default:
+		log.Fatalf("backend value %s is not a valid option (consul, file, prometheus, route53, kubernetes or nomad)", backend)
+	}
+
+	return nil
+}
+
+// newConsulTargets creates a Consul backend for every configured datacenter
+func newConsulTargets(c *cli.Context) []*target {
+	datacenters := c.GlobalStringSlice("consul-datacenter")
+	if len(datacenters) == 0 {
+		datacenters = []string{""}
+	}
+
+	targets := make([]*target, 0)
+	for _, dc := range datacenters {
+		name := "consul"
+		if dc != "" {
+			name = "consul/" + dc
+		}
+
+		targets = append(targets, &target{
+			name: name,
+			backend: cc.NewBackend(cc.Config{
+				InstanceID: instanceID(c),
+				MultiNode:  c.Bool("node-per-instance") || c.Bool("node-per-az"),
+				Datacenter: dc,
+				Namespace:  c.GlobalString("consul-namespace"),
+				Partition:  c.GlobalString("consul-partition"),
+				TokenFile:  c.GlobalString("consul-token-file"),
+				Stale:      c.GlobalBool("consul-stale-reads"),
+			}),
+			state: config.NewCatalogState(),
+		})
+	}
+
+	return targets
 }
 
 // Run ...
 func (r *RDS) Run() {
 	log.Info("Starting RDS app")
 
-	allInstances := observer.NewProperty(nil)
-	filteredInstances := observer.NewProperty(nil)
-	catalogState := &config.CatalogState{}
+	r.allInstances = observer.NewProperty(nil)
+	r.filteredInstances = observer.NewProperty(nil)
 
-	go r.backend.CatalogReader(catalogState, r.consulNodeName, r.quitCh)
-	go r.reader(allInstances)
-	go r.filter(allInstances, filteredInstances)
-	go r.writer(filteredInstances, catalogState)
+	if r.metricsAddr != "" {
+		metrics.Handle("/status/rejections", http.HandlerFunc(r.rejectionsHandler))
+		metrics.Handle("/debug/state", http.HandlerFunc(r.stateHandler))
+		go metrics.Serve(r.metricsAddr)
+	}
+
+	for _, t := range r.targets {
+		go t.backend.CatalogReader(t.state, r.consulNodeName, r.quitCh)
+		go r.writer(r.filteredInstances, t)
+	}
+
+	if r.vault != nil {
+		go r.vaultWriter(r.filteredInstances)
+	}
+
+	go r.reader(r.allInstances)
+	go r.filter(r.allInstances, r.filteredInstances)
 
 	<-r.quitCh
 }
+
+// RunOnce does a single read, filter and write pass and returns the process exit code:
+// 0 if nothing changed, 2 if changes were made and 1 if any operation failed or a
+// backend catalog did not load within --once-timeout
+func (r *RDS) RunOnce() int {
+	logger := log.WithField("worker", "once")
+	logger.Info("Starting RDS app for a single pass")
+
+	for _, t := range r.targets {
+		go t.backend.CatalogReader(t.state, r.consulNodeName, r.quitCh)
+	}
+
+	timeout := time.After(r.onceTimeout)
+	for _, t := range r.targets {
+		logger.Debugf("Waiting for the %s catalog to load", t.name)
+
+		select {
+		case <-t.state.Ready():
+		case <-timeout:
+			logger.Errorf("The %s catalog did not load within %s", t.name, r.onceTimeout)
+			t.recorder.Event("safety-valve", "", fmt.Sprintf("Aborted the pass, the %s catalog did not load within %s", t.name, r.onceTimeout))
+			r.notifier.Send(t.recorder.Events())
+			close(r.quitCh)
+			return 1
+		}
+	}
+
+	snapshot := r.filterSnapshot(r.read("once", logger), logger)
+
+	changes, failures := 0, 0
+	for _, t := range r.targets {
+		r.write(snapshot, t, logger.WithField("target", t.name))
+		changes += t.recorder.Changes
+		failures += t.recorder.Failures
+	}
+
+	if r.vault != nil {
+		r.vault.sync(snapshot.Instances, logger.WithField("sync_id", snapshot.SyncID))
+		changes += r.vault.changes
+		failures += r.vault.failures
+	}
+
+	// let the notifications of the pass go out before exiting
+	r.sending.Wait()
+	close(r.quitCh)
+
+	logger.Infof("Finished single pass with %d changes and %d failures", changes, failures)
+
+	switch {
+	case failures > 0:
+		return 1
+	case changes > 0:
+		return 2
+	default:
+		return 0
+	}
+}
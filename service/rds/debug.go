@@ -0,0 +1,164 @@
+package rds
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	observer "github.com/imkira/go-observer"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/engine"
+	log "github.com/sirupsen/logrus"
+)
+
+// debugState is the pipeline state served on /debug/state
+type debugState struct {
+	AllInstances      *config.Snapshot             `json:"all_instances"`
+	FilteredInstances *config.Snapshot             `json:"filtered_instances"`
+	TagCache          map[string]*debugTagCache    `json:"tag_cache"`
+	Targets           map[string]*debugTargetState `json:"targets"`
+}
+
+// debugTagCache is a cached set of instance tags
+type debugTagCache struct {
+	Tags      config.Tags `json:"tags"`
+	Age       string      `json:"age"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// debugTargetState is the view of a backend target
+type debugTargetState struct {
+	Services         config.Services `json:"services"`
+	Checks           config.Checks   `json:"checks"`
+	LastSync         time.Time       `json:"last_sync"`
+	LastSyncDuration string          `json:"last_sync_duration"`
+	LastSyncID       string          `json:"last_sync_id"`
+	Pending          *debugDiff      `json:"pending"`
+}
+
+// debugDiff is what the next pass would change in a backend target
+type debugDiff struct {
+	Create       []string          `json:"create"`
+	Update       map[string]string `json:"update"`
+	Delete       []string          `json:"delete"`
+	DeleteChecks []string          `json:"delete_checks"`
+}
+
+// stateHandler serves the current pipeline state as JSON
+func (r *RDS) stateHandler(w http.ResponseWriter, req *http.Request) {
+	state := &debugState{
+		AllInstances:      propertySnapshot(r.allInstances),
+		FilteredInstances: propertySnapshot(r.filteredInstances),
+		TagCache:          make(map[string]*debugTagCache),
+		Targets:           make(map[string]*debugTargetState),
+	}
+
+	for arn, item := range r.tagCache.Items() {
+		expiresAt := time.Unix(0, item.Expiration)
+
+		state.TagCache[arn] = &debugTagCache{
+			Tags:      *item.Object.(*config.Tags),
+			Age:       (r.tagCacheTime - time.Until(expiresAt)).Round(time.Second).String(),
+			ExpiresAt: expiresAt,
+		}
+	}
+
+	for _, t := range r.targets {
+		t.state.Lock()
+		services := make(config.Services, len(t.state.Services))
+		for id, service := range t.state.Services {
+			services[id] = service
+		}
+
+		target := &debugTargetState{
+			Services:         services,
+			Checks:           t.state.Checks,
+			LastSync:         t.recorder.LastSync,
+			LastSyncDuration: t.recorder.LastSyncDuration.String(),
+			LastSyncID:       t.recorder.SyncID,
+		}
+		t.state.Unlock()
+
+		if state.FilteredInstances != nil {
+			target.Pending = r.pendingDiff(state.FilteredInstances, services, target.Checks)
+		}
+
+		state.Targets[t.name] = target
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(state)
+}
+
+// pendingDiff compares the services the snapshot would write with the services of a backend target
+func (r *RDS) pendingDiff(snapshot *config.Snapshot, services config.Services, checks config.Checks) *debugDiff {
+	// the comparison logs every difference, which is only useful when writing
+	quiet := log.New()
+	quiet.Out = io.Discard
+	logger := log.NewEntry(quiet)
+
+	diff := &debugDiff{
+		Create:       make([]string, 0),
+		Update:       make(map[string]string),
+		Delete:       make([]string, 0),
+		DeleteChecks: make([]string, 0),
+	}
+
+	owned := make(config.Services)
+	byInstance := make(map[string]*config.Service)
+	for id, service := range services {
+		if service.IsForeign(r.instanceID) {
+			continue
+		}
+
+		owned[id] = service
+		byInstance[service.ServiceMeta["DBInstanceIdentifier"]] = service
+	}
+
+	desired := make(config.Services)
+	nodeAddresses := r.nodeAddresses(snapshot.Instances)
+	for _, instance := range snapshot.Instances {
+		lastFailover := r.lastFailover(instance, byInstance[aws.StringValue(instance.DBInstanceIdentifier)])
+
+		for _, name := range r.getServiceNames(instance) {
+			service := r.buildService(instance, name, lastFailover, nodeAddresses)
+			desired[service.ServiceID] = service
+		}
+	}
+
+	e := &engine.Engine{
+		DefaultNode: r.consulNodeName,
+		Compare: func(existing, desired *config.Service) string {
+			return r.changedField(existing, desired, logger)
+		},
+	}
+
+	for _, op := range e.Plan(desired, owned, checks) {
+		switch {
+		case op.Type == engine.WriteService && op.Before == nil:
+			diff.Create = append(diff.Create, op.ServiceID)
+		case op.Type == engine.WriteService:
+			diff.Update[op.ServiceID] = op.Changed
+		case op.Type == engine.DeleteService && !op.Moved:
+			diff.Delete = append(diff.Delete, op.ServiceID)
+		case op.Type == engine.DeleteCheck:
+			diff.DeleteChecks = append(diff.DeleteChecks, op.CheckID)
+		}
+	}
+
+	return diff
+}
+
+// propertySnapshot returns the current snapshot of a pipeline property, or nil before the first pass
+func propertySnapshot(prop observer.Property) *config.Snapshot {
+	if prop == nil {
+		return nil
+	}
+
+	snapshot, _ := prop.Value().(*config.Snapshot)
+	return snapshot
+}
@@ -0,0 +1,157 @@
+package rds
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// exportedInstance is an RDS instance as seen by the filters, with the services it would be registered as
+type exportedInstance struct {
+	Instance *config.DBInstance `json:"instance"`
+	Services []exportedService  `json:"services"`
+	Excluded string             `json:"excluded,omitempty"`
+}
+
+// exportedService is the computed name and ID of a service
+type exportedService struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+
+	// Duplicate is set when an earlier instance already uses the service ID, see --on-duplicate
+	Duplicate string `json:"duplicate,omitempty"`
+}
+
+var exportColumns = []string{"instance", "engine", "status", "service", "id", "excluded", "tags"}
+
+// Export reads and filters all RDS instances once and writes them to w in the given format (table, json or csv)
+func (r *RDS) Export(w io.Writer, format string) error {
+	logger := log.WithField("worker", "export")
+
+	snapshot := r.read("export", logger)
+
+	instances := make([]*exportedInstance, 0, len(snapshot.Instances))
+	owners := make(map[string]string)
+	for _, instance := range snapshot.Instances {
+		instances = append(instances, r.exportInstance(instance, owners))
+	}
+
+	switch strings.ToLower(format) {
+	case "table":
+		return exportTable(w, instances)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(instances)
+	case "csv":
+		return exportCSV(w, instances)
+	default:
+		return fmt.Errorf("format value %s is not a valid option (table, json or csv)", format)
+	}
+}
+
+// exportInstance returns the services of an instance and why it is excluded. owners maps the service IDs
+// of the included instances exported so far to their instance, to report duplicates like a pass would
+func (r *RDS) exportInstance(instance *config.DBInstance, owners map[string]string) *exportedInstance {
+	exported := &exportedInstance{
+		Instance: instance,
+		Services: make([]exportedService, 0),
+	}
+
+	names := r.getServiceNames(instance)
+	rejection := r.exclusion(instance, names)
+	if rejection != nil {
+		exported.Excluded = rejection.Detail
+	}
+
+	id := aws.StringValue(instance.DBInstanceIdentifier)
+	for _, name := range names {
+		service := exportedService{Name: name, ID: r.getServiceID(instance, name)}
+
+		if rejection == nil {
+			if owner, ok := owners[service.ID]; ok {
+				service.Duplicate = fmt.Sprintf("duplicate service ID, already used by instance %s", owner)
+			} else {
+				owners[service.ID] = id
+			}
+		}
+
+		exported.Services = append(exported.Services, service)
+	}
+
+	return exported
+}
+
+// rows returns one row per service of the instance, or a single row if it has none
+func (e *exportedInstance) rows() [][]string {
+	instance := []string{
+		aws.StringValue(e.Instance.DBInstanceIdentifier),
+		aws.StringValue(e.Instance.Engine),
+		aws.StringValue(e.Instance.DBInstanceStatus),
+	}
+	tags := formatTags(e.Instance.Tags)
+
+	if len(e.Services) == 0 {
+		return [][]string{append(instance, "", "", e.Excluded, tags)}
+	}
+
+	rows := make([][]string, 0, len(e.Services))
+	for _, service := range e.Services {
+		excluded := e.Excluded
+		if excluded == "" {
+			excluded = service.Duplicate
+		}
+
+		row := append([]string{}, instance...)
+		rows = append(rows, append(row, service.Name, service.ID, excluded, tags))
+	}
+
+	return rows
+}
+
+func exportTable(w io.Writer, instances []*exportedInstance) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.ToUpper(strings.Join(exportColumns, "\t")))
+
+	for _, instance := range instances {
+		for _, row := range instance.rows() {
+			fmt.Fprintln(table, strings.Join(row, "\t"))
+		}
+	}
+
+	return table.Flush()
+}
+
+func exportCSV(w io.Writer, instances []*exportedInstance) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+
+	for _, instance := range instances {
+		if err := writer.WriteAll(instance.rows()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatTags returns the tags as sorted key=value pairs
+func formatTags(tags config.Tags) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
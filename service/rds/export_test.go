@@ -0,0 +1,61 @@
+package rds
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+)
+
+func TestExportReportsDuplicates(t *testing.T) {
+	r := &RDS{consulMasterTag: "master", consulReplicaTag: "replica"}
+
+	orders := testInstance("orders", "available")
+	copied := testInstance("orders-copy", "available")
+	copied.Tags["consul_service_name"] = "orders"
+	creating := testInstance("orders-new", "creating")
+	creating.Tags["consul_service_name"] = "orders"
+
+	owners := make(map[string]string)
+	exported := make([]*exportedInstance, 0)
+	for _, instance := range []*config.DBInstance{orders, creating, copied} {
+		exported = append(exported, r.exportInstance(instance, owners))
+	}
+
+	if service := exported[0].Services[0]; service.ID != "orders" || service.Duplicate != "" {
+		t.Errorf("got first service %+v", service)
+	}
+
+	// an excluded instance is not written, it does not take the ID
+	if service := exported[1].Services[0]; service.Duplicate != "" {
+		t.Errorf("got excluded service %+v", service)
+	}
+
+	if service := exported[2].Services[0]; service.Duplicate != "duplicate service ID, already used by instance orders" {
+		t.Errorf("got duplicate service %+v", service)
+	}
+
+	row := exported[2].rows()[0]
+	if row[5] != "duplicate service ID, already used by instance orders" {
+		t.Errorf("got row %v", row)
+	}
+}
+
+func TestExportWithoutServiceName(t *testing.T) {
+	r := &RDS{}
+
+	instance := testInstance("orders", "available")
+	instance.DBName = nil
+	delete(instance.Tags, "consul_service_name")
+
+	exported := r.exportInstance(instance, make(map[string]string))
+	if len(exported.Services) != 0 || !strings.Contains(exported.Excluded, "no consul_service_names") {
+		t.Errorf("got %+v", exported)
+	}
+
+	rows := exported.rows()
+	if len(rows) != 1 || rows[0][0] != aws.StringValue(instance.DBInstanceIdentifier) {
+		t.Errorf("got rows %v", rows)
+	}
+}
@@ -0,0 +1,163 @@
+package rds
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/metrics"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// topology is the placement and replication role of an instance as seen in the previous pass
+type topology struct {
+	AvailabilityZone string
+	Role             string
+	LastFailover     string
+}
+
+// getRole returns master, replica or standalone (an instance without replication)
+func getRole(instance *config.DBInstance) string {
+	switch {
+	case instance.ReadReplicaSourceDBInstanceIdentifier != nil:
+		return "replica"
+	case len(instance.ReadReplicaDBInstanceIdentifiers) > 0:
+		return "master"
+	default:
+		return "standalone"
+	}
+}
+
+// detectFailovers compares the availability zone and replication role of every instance of the
+// snapshot with the previous pass, or with the remote catalogs after a restart. It runs once per
+// snapshot whatever the number of targets, every change is logged, counted and sent once
+func (r *RDS) detectFailovers(snapshot *config.Snapshot, logger *log.Entry) {
+	catalog := r.catalogTopology()
+	events := make([]*notify.Event, 0)
+
+	r.topologyLock.Lock()
+	for _, instance := range snapshot.Instances {
+		events = append(events, r.detectFailover(instance, catalog)...)
+	}
+	r.topologyLock.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+
+	for _, event := range events {
+		logger.WithFields(log.Fields{"instance": event.Service, "event": event.Type, "from": event.Fields["from"], "to": event.Fields["to"]}).Warn(event.Message)
+		metrics.Failovers.WithLabelValues(event.Type).Inc()
+	}
+
+	r.sending.Add(1)
+	go func() {
+		defer r.sending.Done()
+
+		r.notifier.Send(events)
+
+		if r.failoverWebhook != nil {
+			if err := r.failoverWebhook.Send(events); err != nil {
+				logger.Errorf("Could not send failover webhook: %s", err)
+			}
+		}
+	}()
+}
+
+// detectFailover records the topology of an instance and returns its changes since the previous pass.
+// Must be called with the topology lock held
+func (r *RDS) detectFailover(instance *config.DBInstance, catalog map[string]*topology) []*notify.Event {
+	id := aws.StringValue(instance.DBInstanceIdentifier)
+	current := &topology{
+		AvailabilityZone: aws.StringValue(instance.AvailabilityZone),
+		Role:             getRole(instance),
+	}
+
+	previous, ok := r.topology[id]
+	if !ok {
+		previous = catalog[id]
+	}
+	r.topology[id] = current
+
+	if previous == nil {
+		return nil
+	}
+	current.LastFailover = previous.LastFailover
+
+	events := make([]*notify.Event, 0)
+
+	if previous.AvailabilityZone != "" && previous.AvailabilityZone != current.AvailabilityZone {
+		events = append(events, &notify.Event{
+			Type:    "failover",
+			Message: fmt.Sprintf("Instance %s moved from availability zone %s to %s", id, previous.AvailabilityZone, current.AvailabilityZone),
+			Fields:  map[string]string{"from": previous.AvailabilityZone, "to": current.AvailabilityZone},
+		})
+	}
+
+	if previous.Role != "" && previous.Role != current.Role {
+		events = append(events, &notify.Event{
+			Type:    "role-change",
+			Message: fmt.Sprintf("Instance %s changed replication role from %s to %s", id, previous.Role, current.Role),
+			Fields:  map[string]string{"from": previous.Role, "to": current.Role},
+		})
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	current.LastFailover = now.Format(time.RFC3339)
+
+	for _, event := range events {
+		event.Service = id
+		event.Time = now
+		event.Fields["instance"] = id
+	}
+
+	return events
+}
+
+// catalogTopology returns the topology of the instances found in the catalogs of the targets,
+// used as the previous pass after a restart
+func (r *RDS) catalogTopology() map[string]*topology {
+	catalog := make(map[string]*topology)
+
+	for _, t := range r.targets {
+		t.state.Lock()
+		for _, service := range t.state.Services {
+			id := service.ServiceMeta["DBInstanceIdentifier"]
+			if id == "" || catalog[id] != nil || service.IsForeign(r.instanceID) {
+				continue
+			}
+
+			catalog[id] = &topology{
+				AvailabilityZone: service.ServiceMeta["AvailabilityZone"],
+				Role:             service.ServiceMeta["ReplicationRole"],
+				LastFailover:     service.ServiceMeta["LastFailover"],
+			}
+		}
+		t.state.Unlock()
+	}
+
+	return catalog
+}
+
+// lastFailover returns when the instance last changed availability zone or replication role,
+// falling back to the meta of its existing service when the change happened before a restart
+func (r *RDS) lastFailover(instance *config.DBInstance, existing *config.Service) string {
+	r.topologyLock.Lock()
+	defer r.topologyLock.Unlock()
+
+	if current, ok := r.topology[aws.StringValue(instance.DBInstanceIdentifier)]; ok && current.LastFailover != "" {
+		return current.LastFailover
+	}
+
+	if existing != nil {
+		return existing.ServiceMeta["LastFailover"]
+	}
+
+	return ""
+}
@@ -1,6 +1,8 @@
 package rds
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -21,67 +23,111 @@ func (r *RDS) filter(all, filtered observer.Property) {
 
 		// wait for changes
 		case <-stream.Changes():
-			logger.Debug("Starting filtering RDS instances")
-
 			stream.Next()
-			instances := stream.Value().([]*config.DBInstance)
+			filtered.Update(r.filterSnapshot(stream.Value().(*config.Snapshot), logger))
+		}
+	}
+}
 
-			filteredInstances := make([]*config.DBInstance, 0)
+// filterSnapshot returns a snapshot with only the instances matching the filters
+func (r *RDS) filterSnapshot(snapshot *config.Snapshot, logger *log.Entry) *config.Snapshot {
+	logger.Debug("Starting filtering RDS instances")
 
-			for _, instance := range instances {
-				if !r.filterByInstanceData(instance, r.instanceFilters) {
-					continue
-				}
+	filteredInstances := make([]*config.DBInstance, 0)
+	rejected := make([]*rejection, 0)
 
-				if !r.filterByInstanceTags(instance, r.tagFilters) {
-					continue
-				}
+	for _, instance := range snapshot.Instances {
+		if rejection := r.exclusion(instance, r.getServiceNames(instance)); rejection != nil {
+			logger.Debugf("Excluding %s (%s): %s", rejection.Instance, rejection.Reason, rejection.Detail)
+			rejected = append(rejected, rejection)
+			continue
+		}
 
-				filteredInstances = append(filteredInstances, instance)
-			}
+		filteredInstances = append(filteredInstances, instance)
+	}
 
-			filtered.Update(filteredInstances)
-			logger.Debug("Finished filtering RDS instances")
-		}
+	r.setRejected(rejected)
+
+	filtered := &config.Snapshot{
+		Instances: filteredInstances,
+		Trigger:   snapshot.Trigger,
+		SyncID:    snapshot.SyncID,
+	}
+	r.detectFailovers(filtered, logger.WithField("sync_id", snapshot.SyncID))
+
+	logger.Debug("Finished filtering RDS instances")
+	return filtered
+}
+
+// exclusion returns why an instance with the given service names is excluded, or nil if it is included
+func (r *RDS) exclusion(instance *config.DBInstance, names []string) *rejection {
+	id := aws.StringValue(instance.DBInstanceIdentifier)
+
+	if reason, detail := r.filterByInstanceData(instance, r.instanceFilters); reason != "" {
+		return &rejection{Instance: id, Reason: reason, Detail: detail}
+	}
+
+	if reason, detail := r.filterByInstanceTags(instance, r.tagFilters); reason != "" {
+		return &rejection{Instance: id, Reason: reason, Detail: detail}
+	}
+
+	if r.remoteReplicas == "exclude" && isRemoteReplica(instance) {
+		return &rejection{Instance: id, Reason: reasonRemoteReplica, Detail: "replica of an instance in another region or account"}
+	}
+
+	if aws.StringValue(instance.DBInstanceStatus) == "creating" {
+		return &rejection{Instance: id, Reason: reasonCreating, Detail: "the instance is being created"}
+	}
+
+	if instance.Endpoint == nil {
+		return &rejection{Instance: id, Reason: reasonNoEndpoint, Detail: fmt.Sprintf("the instance does not have an endpoint yet, it is in state %s", aws.StringValue(instance.DBInstanceStatus))}
 	}
+
+	if len(names) == 0 {
+		return &rejection{Instance: id, Reason: reasonNoServiceName, Detail: "the instance has no consul_service_names or consul_service_name tag and no DB name"}
+	}
+
+	return nil
 }
 
-// Returns true if the instance matches all filters provided. If no filters are provided, returns true.
-func (r *RDS) filterByInstanceData(instance *config.DBInstance, filters config.Filters) bool {
+// Returns the reason and detail of the first filter provided the instance does not match, or empty strings if it matches all of them. If no filters are provided, returns empty strings.
+func (r *RDS) filterByInstanceData(instance *config.DBInstance, filters config.Filters) (string, string) {
 	if len(filters) == 0 {
-		return true
+		return "", ""
 	}
 
-	for k, filter := range filters {
-		isMatch := false
+	for _, k := range sortedKeys(filters) {
+		filter := filters[k]
+		var value string
 
 		switch k {
 		case "AvailabilityZone":
-			isMatch = r.matches(filter, aws.StringValue(instance.AvailabilityZone))
+			value = aws.StringValue(instance.AvailabilityZone)
 		case "DBInstanceArn":
-			isMatch = r.matches(filter, aws.StringValue(instance.DBInstanceArn))
+			value = aws.StringValue(instance.DBInstanceArn)
 		case "DBInstanceClass":
-			isMatch = r.matches(filter, aws.StringValue(instance.DBInstanceClass))
+			value = aws.StringValue(instance.DBInstanceClass)
 		case "DBInstanceIdentifier":
-			isMatch = r.matches(filter, aws.StringValue(instance.DBInstanceIdentifier))
+			value = aws.StringValue(instance.DBInstanceIdentifier)
 		case "DBInstanceStatus":
-			isMatch = r.matches(filter, aws.StringValue(instance.DBInstanceStatus))
+			value = aws.StringValue(instance.DBInstanceStatus)
 		case "Engine":
-			isMatch = r.matches(filter, aws.StringValue(instance.Engine))
+			value = aws.StringValue(instance.Engine)
 		case "EngineVersion":
-			isMatch = r.matches(filter, aws.StringValue(instance.EngineVersion))
+			value = aws.StringValue(instance.EngineVersion)
 		case "VpcId":
-			isMatch = r.matches(filter, aws.StringValue(instance.DBSubnetGroup.VpcId))
+			value = aws.StringValue(instance.DBSubnetGroup.VpcId)
 		default:
 			log.Warnf("Unknown instance filter key %s (%s)", k, filter)
+			return reasonInstanceFilter, fmt.Sprintf("unknown instance filter key %s", k)
 		}
 
-		if !isMatch {
-			return false
+		if !r.matches(filter, value) {
+			return reasonInstanceFilter, fmt.Sprintf("instance filter %s=%s does not match %q", k, filter, value)
 		}
 	}
 
-	return true
+	return "", ""
 }
 
 func (r *RDS) matches(filter, value string) bool {
@@ -94,26 +140,39 @@ func (r *RDS) matches(filter, value string) bool {
 	return false
 }
 
-func (r *RDS) filterByInstanceTags(instance *config.DBInstance, filters config.Filters) bool {
+// Returns the reason and detail of the first tag filter provided the instance does not match, or empty strings if it matches all of them
+func (r *RDS) filterByInstanceTags(instance *config.DBInstance, filters config.Filters) (string, string) {
 	if len(filters) == 0 {
-		return true
+		return "", ""
 	}
 
 	tags := instance.Tags
 
-	for k, v := range filters {
+	for _, k := range sortedKeys(filters) {
+		v := filters[k]
 		val, ok := tags[k]
 
 		// the tag key doesn't exist
 		if !ok {
-			return false
+			return reasonTagMissing, fmt.Sprintf("tag filter %s=%s does not match, the tag is missing", k, v)
 		}
 
 		// the value doesn't match
 		if val != v {
-			return false
+			return reasonTagFilter, fmt.Sprintf("tag filter %s=%s does not match %q", k, v, val)
 		}
 	}
 
-	return true
+	return "", ""
+}
+
+// sortedKeys returns the filter keys in a stable order, so the same filter is always reported first
+func sortedKeys(filters config.Filters) []string {
+	keys := make([]string, 0, len(filters))
+	for k := range filters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
 }
@@ -0,0 +1,38 @@
+package rds
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// testInstance returns an available-looking postgres instance with its service name tag
+func testInstance(id, status string) *config.DBInstance {
+	return &config.DBInstance{
+		DBInstance: &rds.DBInstance{
+			DBInstanceIdentifier:  aws.String(id),
+			DBInstanceArn:         aws.String("arn:aws:rds:us-east-1:123456789012:db:" + id),
+			DBInstanceStatus:      aws.String(status),
+			DBInstanceClass:       aws.String("db.t3.micro"),
+			DBName:                aws.String(id),
+			Engine:                aws.String("postgres"),
+			EngineVersion:         aws.String("16.3"),
+			AvailabilityZone:      aws.String("us-east-1a"),
+			MultiAZ:               aws.Bool(false),
+			Endpoint:              &rds.Endpoint{Address: aws.String(id + ".rds.amazonaws.com"), Port: aws.Int64(5432)},
+			PendingModifiedValues: &rds.PendingModifiedValues{},
+		},
+		Tags: config.Tags{"consul_service_name": id},
+	}
+}
+
+// quietLogger returns a logger discarding its output
+func quietLogger() *log.Entry {
+	quiet := log.New()
+	quiet.Out = io.Discard
+
+	return log.NewEntry(quiet)
+}
@@ -1,8 +1,11 @@
 package rds
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -27,7 +30,7 @@ func (r *RDS) reader(prop observer.Property) {
 	signal.Notify(sigs, syscall.SIGUSR1)
 
 	// read right away on start
-	r.read(prop, logger)
+	prop.Update(r.read("startup", logger))
 
 	for {
 		select {
@@ -35,18 +38,21 @@ func (r *RDS) reader(prop observer.Property) {
 			return
 
 		case <-sigs:
-			r.read(prop, logger)          // run updater
-			ticker.Reset(r.checkInterval) // schedule new timed run
+			prop.Update(r.read("signal", logger)) // run updater
+			ticker.Reset(r.checkInterval)         // schedule new timed run
 
 		case <-ticker.C:
-			r.read(prop, logger)          // run updater
-			ticker.Reset(r.checkInterval) // schedule new timed run
+			prop.Update(r.read("timer", logger)) // run updater
+			ticker.Reset(r.checkInterval)        // schedule new timed run
 		}
 	}
 }
 
-func (r *RDS) read(prop observer.Property, logger *log.Entry) {
-	logger.Debug("Starting refresh of RDS information")
+// read returns a snapshot of all RDS instances
+func (r *RDS) read(trigger string, logger *log.Entry) *config.Snapshot {
+	syncID := newSyncID()
+	logger = logger.WithField("sync_id", syncID)
+	logger.Debugf("Starting refresh of RDS information (trigger: %s)", trigger)
 
 	var marker *string
 	pages := 0
@@ -81,7 +87,7 @@ func (r *RDS) read(prop observer.Property, logger *log.Entry) {
 
 		marker = resp.Marker
 		for _, instance := range resp.DBInstances {
-			instances = append(instances, &config.DBInstance{instance, r.getInstanceTags(instance)})
+			instances = append(instances, &config.DBInstance{DBInstance: instance, Tags: r.getInstanceTags(instance)})
 		}
 
 		if marker == nil {
@@ -90,8 +96,23 @@ func (r *RDS) read(prop observer.Property, logger *log.Entry) {
 		}
 	}
 
-	prop.Update(instances)
 	logger.Debug("Finished refresh of RDS information")
+
+	return &config.Snapshot{
+		Instances: instances,
+		Trigger:   trigger,
+		SyncID:    syncID,
+	}
+}
+
+// newSyncID returns a random identifier for a pass
+func newSyncID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(b)
 }
 
 func (r *RDS) getInstanceTags(instance *rds.DBInstance) config.Tags {
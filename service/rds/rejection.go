@@ -0,0 +1,78 @@
+package rds
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/metrics"
+)
+
+// Rejection reasons, used as the metrics reason label
+const (
+	reasonInstanceFilter = "instance_filter"
+	reasonTagFilter      = "tag_filter"
+	reasonTagMissing     = "tag_missing"
+	reasonRemoteReplica  = "remote_replica"
+	reasonCreating       = "creating"
+	reasonNoEndpoint     = "no_endpoint"
+	reasonNoServiceName  = "no_service_name"
+	reasonDuplicateID    = "duplicate_id"
+)
+
+// rejection is why an instance was filtered out, or why one of its services was not written
+type rejection struct {
+	Instance string `json:"instance"`
+	Service  string `json:"service,omitempty"`
+	Reason   string `json:"reason"`
+	Detail   string `json:"detail"`
+}
+
+// setRejected replaces the rejections of the filter stage
+func (r *RDS) setRejected(rejected []*rejection) {
+	metrics.ExcludedInstances.Reset()
+	for _, rejection := range rejected {
+		metrics.ExcludedInstances.WithLabelValues(rejection.Reason).Inc()
+	}
+
+	r.rejectedLock.Lock()
+	r.rejected = rejected
+	r.rejectedLock.Unlock()
+}
+
+// resetRejected clears the rejections of the target at the start of a pass
+func (r *RDS) resetRejected(t *target) {
+	metrics.SkippedServices.DeletePartialMatch(prometheus.Labels{"target": t.name})
+	t.rejected = nil
+}
+
+// reject records a service of the target that was not written in the current pass
+func (r *RDS) reject(t *target, rejection *rejection) {
+	metrics.SkippedServices.WithLabelValues(t.name, rejection.Reason).Inc()
+	t.rejected = append(t.rejected, rejection)
+}
+
+// rejectionsHandler serves the rejections of the last pass as JSON
+func (r *RDS) rejectionsHandler(w http.ResponseWriter, req *http.Request) {
+	status := struct {
+		Filter  []*rejection            `json:"filter"`
+		Targets map[string][]*rejection `json:"targets"`
+	}{
+		Targets: make(map[string][]*rejection),
+	}
+
+	r.rejectedLock.Lock()
+	status.Filter = r.rejected
+	r.rejectedLock.Unlock()
+
+	for _, t := range r.targets {
+		t.state.Lock()
+		status.Targets[t.name] = t.rejected
+		t.state.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(status)
+}
@@ -0,0 +1,62 @@
+package rds
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+)
+
+// replicaSource is the source instance of a read replica
+type replicaSource struct {
+	Identifier string
+	Region     string
+	Account    string
+}
+
+// getReplicaSource returns the source of a read replica, or nil if the instance is not a replica.
+// Sources in the same region are plain identifiers, cross-region sources are ARNs
+func getReplicaSource(instance *config.DBInstance) *replicaSource {
+	value := aws.StringValue(instance.ReadReplicaSourceDBInstanceIdentifier)
+	if value == "" {
+		return nil
+	}
+
+	instanceArn, _ := arn.Parse(aws.StringValue(instance.DBInstanceArn))
+
+	if !arn.IsARN(value) {
+		return &replicaSource{
+			Identifier: value,
+			Region:     instanceArn.Region,
+			Account:    instanceArn.AccountID,
+		}
+	}
+
+	sourceArn, err := arn.Parse(value)
+	if err != nil {
+		return &replicaSource{Identifier: value}
+	}
+
+	return &replicaSource{
+		// the resource is in the form db:<identifier>
+		Identifier: strings.TrimPrefix(sourceArn.Resource, "db:"),
+		Region:     sourceArn.Region,
+		Account:    sourceArn.AccountID,
+	}
+}
+
+// isRemoteReplica returns true if the instance is a replica of an instance in another region or account
+func isRemoteReplica(instance *config.DBInstance) bool {
+	source := getReplicaSource(instance)
+	if source == nil {
+		return false
+	}
+
+	instanceArn, err := arn.Parse(aws.StringValue(instance.DBInstanceArn))
+	if err != nil {
+		return false
+	}
+
+	return source.Region != instanceArn.Region || source.Account != instanceArn.AccountID
+}
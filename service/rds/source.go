@@ -0,0 +1,95 @@
+package rds
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// source produces the desired services of a target from a snapshot of RDS instances
+type source struct {
+	r        *RDS
+	snapshot *config.Snapshot
+	t        *target
+	logger   *log.Entry
+
+	// existing is the catalog of the target, the last failover of an instance is kept from it after a restart
+	existing config.Services
+
+	// count is the number of desired services
+	count int
+}
+
+// Services ...
+func (s *source) Services() config.Services {
+	byInstance := make(map[string]*config.Service)
+	for _, service := range s.existing {
+		byInstance[service.ServiceMeta["DBInstanceIdentifier"]] = service
+	}
+
+	desired := make(config.Services)
+	checks := make(map[string]bool)
+	now := time.Now().UTC().Format(time.RFC3339)
+	nodeAddresses := s.r.nodeAddresses(s.snapshot.Instances)
+
+	for _, instance := range s.snapshot.Instances {
+		id := aws.StringValue(instance.DBInstanceIdentifier)
+		logger := s.logger.WithField("instance", id)
+
+		lastFailover := s.r.lastFailover(instance, byInstance[id])
+
+		for _, name := range s.r.getServiceNames(instance) {
+			service := s.r.buildService(instance, name, lastFailover, nodeAddresses)
+
+			logger.Debugf("  Node: %s", service.CheckNode)
+			logger.Debugf("  ID:   %s", service.ServiceID)
+			logger.Debugf("  Name: %s", name)
+			logger.Debugf("  Addr: %s", service.ServiceAddress)
+			logger.Debugf("  Port: %d", service.ServicePort)
+
+			if _, ok := desired[service.ServiceID]; ok {
+				if s.duplicate(instance, service, fmt.Sprintf("service ID %s", service.ServiceID), logger) {
+					continue
+				}
+			}
+
+			if checks[service.CheckID] {
+				if s.duplicate(instance, service, fmt.Sprintf("check ID %s", service.CheckID), logger) {
+					continue
+				}
+			}
+
+			// only written along with a change, the content hash leaves it out
+			service.ServiceMeta[config.MetaLastSync] = now
+
+			desired[service.ServiceID] = service
+			checks[service.CheckID] = true
+		}
+	}
+
+	s.count = len(desired)
+	return desired
+}
+
+// duplicate handles a service or check ID used by more than one instance according to --on-duplicate,
+// and returns true if the service should be skipped
+func (s *source) duplicate(instance *config.DBInstance, service *config.Service, what string, logger *log.Entry) bool {
+	logger.Errorf("Found duplicate %s - possible duplicate 'consul_service_name' RDS tag with same Replication Role", what)
+	s.r.reject(s.t, &rejection{Instance: aws.StringValue(instance.DBInstanceIdentifier), Service: service.ServiceID, Reason: reasonDuplicateID, Detail: "duplicate " + what})
+	s.t.recorder.Event("duplicate", service.ServiceID, fmt.Sprintf("Found duplicate %s (instance %s)", what, aws.StringValue(instance.DBInstanceIdentifier)))
+
+	if s.r.onDuplicate == "quit" {
+		s.t.recorder.Event("safety-valve", service.ServiceID, fmt.Sprintf("Aborted the pass on duplicate %s, see --on-duplicate", what))
+		s.r.quit(s.t)
+	}
+
+	if s.r.onDuplicate == "ignore-skip-last" {
+		logger.Errorf("Ignoring current service")
+		return true
+	}
+
+	return false
+}
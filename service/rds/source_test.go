@@ -0,0 +1,69 @@
+package rds
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/engine"
+)
+
+// benchmarkSource returns a source of n RDS instances, and the catalog of a previous pass where 10% of
+// the instances did not exist yet, 10% of the services are gone and 10% of the instances changed status
+func benchmarkSource(n int) (*RDS, *source, config.Services) {
+	logger := quietLogger()
+
+	r := &RDS{
+		topology:         make(map[string]*topology),
+		consulNodeName:   "rds",
+		instanceID:       "rds",
+		consulMasterTag:  "master",
+		consulReplicaTag: "replica",
+	}
+
+	snapshot := &config.Snapshot{}
+	for i := 0; i < n; i++ {
+		snapshot.Instances = append(snapshot.Instances, testInstance(fmt.Sprintf("db-%05d", i), "available"))
+	}
+
+	existing := make(config.Services, n)
+	for i, instance := range snapshot.Instances {
+		switch i % 10 {
+		case 0:
+			instance = testInstance(fmt.Sprintf("gone-%05d", i), "available")
+		case 5:
+			instance = testInstance(aws.StringValue(instance.DBInstanceIdentifier), "modifying")
+		}
+
+		service := r.buildService(instance, instance.Tags["consul_service_name"], "", nil)
+		existing[service.ServiceID] = service
+	}
+
+	s := &source{r: r, snapshot: snapshot, existing: existing, t: &target{name: "bench"}, logger: logger}
+	return r, s, existing
+}
+
+func BenchmarkSourceServices(b *testing.B) {
+	_, s, _ := benchmarkSource(10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Services()
+	}
+}
+
+func BenchmarkReconcile(b *testing.B) {
+	r, s, existing := benchmarkSource(10000)
+	e := &engine.Engine{
+		DefaultNode: r.consulNodeName,
+		Compare: func(a, b *config.Service) string {
+			return r.changedField(a, b, s.logger)
+		},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Plan(s.Services(), existing, nil)
+	}
+}
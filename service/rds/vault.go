@@ -0,0 +1,498 @@
+package rds
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	vault "github.com/hashicorp/vault/api"
+	observer "github.com/imkira/go-observer"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/metrics"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// vaultOwnerKey is the connection field marking a connection as written by us, holding the instance ID.
+	// Vault keeps unknown connection fields in the connection details
+	vaultOwnerKey = "aws_dynamic_consul_catalog_owner"
+
+	// vaultPasswordHashKey is the connection field holding a bcrypt hash of the password last written
+	vaultPasswordHashKey = "aws_dynamic_consul_catalog_password_hash"
+)
+
+// vaultPlugins are the default Vault database plugins by RDS engine
+var vaultPlugins = map[string]string{
+	"aurora":            "mysql-aurora-database-plugin",
+	"aurora-mysql":      "mysql-aurora-database-plugin",
+	"aurora-postgresql": "postgresql-database-plugin",
+	"mariadb":           "mysql-rds-database-plugin",
+	"mysql":             "mysql-rds-database-plugin",
+	"postgres":          "postgresql-database-plugin",
+	"sqlserver-ee":      "mssql-database-plugin",
+	"sqlserver-ex":      "mssql-database-plugin",
+	"sqlserver-se":      "mssql-database-plugin",
+	"sqlserver-web":     "mssql-database-plugin",
+}
+
+// vaultConnectionURLs are the default connection URL templates by Vault plugin.
+// Templates use [[ ]] delimiters so Vault's own {{username}} and {{password}} are kept as is
+var vaultConnectionURLs = map[string]string{
+	"mysql-aurora-database-plugin": "{{username}}:{{password}}@tcp([[.Address]]:[[.Port]])/",
+	"mysql-rds-database-plugin":    "{{username}}:{{password}}@tcp([[.Address]]:[[.Port]])/",
+	"postgresql-database-plugin":   "postgresql://{{username}}:{{password}}@[[.Address]]:[[.Port]]/[[or .DBName \"postgres\"]]",
+	"mssql-database-plugin":        "sqlserver://{{username}}:{{password}}@[[.Address]]:[[.Port]]",
+}
+
+// vaultSink keeps Vault database secrets engine connections in sync with the RDS instances
+type vaultSink struct {
+	client         *vault.Client
+	mount          string
+	prefix         string
+	owner          string
+	plugins        map[string]string
+	connectionURLs map[string]*template.Template
+	allowedRoles   string
+	username       string
+	verify         bool
+
+	// password is read from passwordFile, and re-read at the start of a pass whenever the file is modified
+	passwordFile    string
+	password        string
+	passwordModTime time.Time
+
+	// written is the password known to be in each connection, written by us or matching the stored
+	// password hash. Vault never returns the password, so the hash is only checked once per connection
+	written map[string]string
+
+	// changes and failures count the operations of the current pass
+	changes  int
+	failures int
+}
+
+// vaultConnection is the Vault connection configuration for an instance
+type vaultConnection struct {
+	Name          string
+	PluginName    string
+	ConnectionURL string
+	AllowedRoles  []string
+	Username      string
+	Verify        bool
+
+	// Owner and PasswordHash are only set on connections read from Vault
+	Owner        string
+	PasswordHash string
+}
+
+// vaultTemplateData is the data available to connection URL templates
+type vaultTemplateData struct {
+	Identifier string
+	Address    string
+	Port       int64
+	DBName     string
+	Engine     string
+	Tags       config.Tags
+}
+
+func newVaultSink(c *cli.Context) *vaultSink {
+	if !c.Bool("vault-sync") {
+		return nil
+	}
+
+	client, err := vault.NewClient(vault.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Can not create Vault client: %s", err)
+	}
+
+	sink := &vaultSink{
+		client:         client,
+		mount:          strings.Trim(c.String("vault-mount"), "/"),
+		prefix:         c.String("vault-connection-prefix"),
+		owner:          instanceID(c),
+		plugins:        make(map[string]string),
+		connectionURLs: make(map[string]*template.Template),
+		allowedRoles:   c.String("vault-allowed-roles"),
+		username:       c.String("vault-username"),
+		verify:         c.Bool("vault-verify-connection"),
+		passwordFile:   c.String("vault-password-file"),
+		written:        make(map[string]string),
+	}
+
+	if err := sink.readPassword(); err != nil {
+		log.Fatalf("Could not read Vault password file: %s", err)
+	}
+
+	for engine, plugin := range vaultPlugins {
+		sink.plugins[engine] = plugin
+	}
+	for engine, plugin := range parseKeyValues(c.StringSlice("vault-plugin")) {
+		sink.plugins[engine] = plugin
+	}
+
+	urls := make(map[string]string)
+	for plugin, url := range vaultConnectionURLs {
+		urls[plugin] = url
+	}
+	for plugin, url := range parseKeyValues(c.StringSlice("vault-connection-url")) {
+		urls[plugin] = url
+	}
+
+	for plugin, url := range urls {
+		tmpl, err := template.New(plugin).Delims("[[", "]]").Parse(url)
+		if err != nil {
+			log.Fatalf("Invalid Vault connection URL template for %s: %s", plugin, err)
+		}
+		sink.connectionURLs[plugin] = tmpl
+	}
+
+	return sink
+}
+
+// parseKeyValues converts a CLI string slice of key=value into a map, values may contain '='
+func parseKeyValues(values []string) map[string]string {
+	results := make(map[string]string)
+
+	for _, value := range values {
+		split := strings.SplitN(value, "=", 2)
+		if len(split) != 2 {
+			log.Fatalf("Invalid value %s, must be key=value format", value)
+		}
+
+		results[split[0]] = split[1]
+	}
+
+	return results
+}
+
+func (r *RDS) vaultWriter(prop observer.Property) {
+	logger := log.WithField("worker", "vault-writer")
+	logger.Info("Starting Vault database connection writer")
+
+	stream := prop.Observe()
+
+	for {
+		select {
+		case <-r.quitCh:
+			return
+
+		// wait for changes
+		case <-stream.Changes():
+			logger.Debug("Starting Vault database connection write")
+
+			stream.Next()
+			snapshot := stream.Value().(*config.Snapshot)
+
+			r.vault.sync(snapshot.Instances, logger.WithField("sync_id", snapshot.SyncID))
+
+			logger.Debug("Finished Vault database connection write")
+		}
+	}
+}
+
+// readPassword re-reads the password file if it was modified since the last read.
+// On error the last known password is kept
+func (v *vaultSink) readPassword() error {
+	if v.passwordFile == "" {
+		return nil
+	}
+
+	info, err := os.Stat(v.passwordFile)
+	if err != nil {
+		return err
+	}
+
+	if !info.ModTime().After(v.passwordModTime) && v.password != "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(v.passwordFile)
+	if err != nil {
+		return err
+	}
+
+	password := strings.TrimSpace(string(data))
+	if v.password != "" && password != v.password {
+		log.WithField("worker", "vault-writer").Infof("Vault password file %s changed, rewriting all connections", v.passwordFile)
+	}
+
+	v.password = password
+	v.passwordModTime = info.ModTime()
+
+	return nil
+}
+
+func (v *vaultSink) sync(instances []*config.DBInstance, logger *log.Entry) {
+	v.changes, v.failures = 0, 0
+
+	if err := v.readPassword(); err != nil {
+		logger.Errorf("Could not read Vault password file, keeping the last known password: %s", err)
+		v.failures++
+	}
+
+	existing, err := v.list()
+	if err != nil {
+		logger.Errorf("Could not list Vault database connections: %s", err)
+		v.failures++
+		return
+	}
+
+	found := make(map[string]bool)
+
+	for _, instance := range instances {
+		connection := v.connection(instance, logger)
+		if connection == nil {
+			continue
+		}
+		found[connection.Name] = true
+
+		current, err := v.read(connection.Name)
+		if err != nil {
+			logger.Errorf("Could not read Vault database connection %s: %s", connection.Name, err)
+			v.failures++
+			continue
+		}
+
+		if current != nil && current.Owner != "" && current.Owner != v.owner {
+			logger.Errorf("Vault database connection %s is managed by %s, not overwriting it", connection.Name, current.Owner)
+			v.failures++
+			continue
+		}
+
+		if current != nil && current.identical(connection) && current.Owner == v.owner && v.passwordWritten(current) {
+			logger.Debugf("Vault database connection %s is identical, skipping", connection.Name)
+			continue
+		}
+
+		logger.Infof("Writing Vault database connection %s", connection.Name)
+		v.track("write_connection", v.write(connection), logger)
+	}
+
+	for _, name := range existing {
+		if found[name] {
+			continue
+		}
+
+		current, err := v.read(name)
+		if err != nil {
+			logger.Errorf("Could not read Vault database connection %s: %s", name, err)
+			v.failures++
+			continue
+		}
+
+		if current == nil || current.Owner != v.owner {
+			logger.Debugf("Vault database connection %s is not managed by %s, not deleting it", name, v.owner)
+			continue
+		}
+
+		logger.Warnf("Deleting Vault database connection %s", name)
+		_, err = v.client.Logical().Delete(v.path(name))
+		if err != nil {
+			err = fmt.Errorf("could not delete Vault database connection %s: %s", name, err)
+		} else {
+			delete(v.written, name)
+		}
+		v.track("delete_connection", err, logger)
+	}
+}
+
+// connection returns the desired connection for an instance, or nil if it should not have one
+func (v *vaultSink) connection(instance *config.DBInstance, logger *log.Entry) *vaultConnection {
+	logger = logger.WithField("instance", aws.StringValue(instance.DBInstanceIdentifier))
+
+	if instance.Endpoint == nil {
+		logger.Debug("Instance does not have an endpoint yet, skipping Vault database connection")
+		return nil
+	}
+
+	engine := aws.StringValue(instance.Engine)
+	plugin, ok := v.plugins[engine]
+	if !ok {
+		logger.Debugf("No Vault database plugin for engine %s, skipping", engine)
+		return nil
+	}
+
+	tmpl, ok := v.connectionURLs[plugin]
+	if !ok {
+		logger.Errorf("No Vault connection URL template for plugin %s, skipping", plugin)
+		return nil
+	}
+
+	var url bytes.Buffer
+	err := tmpl.Execute(&url, &vaultTemplateData{
+		Identifier: aws.StringValue(instance.DBInstanceIdentifier),
+		Address:    aws.StringValue(instance.Endpoint.Address),
+		Port:       aws.Int64Value(instance.Endpoint.Port),
+		DBName:     aws.StringValue(instance.DBName),
+		Engine:     engine,
+		Tags:       instance.Tags,
+	})
+	if err != nil {
+		logger.Errorf("Could not render Vault connection URL: %s", err)
+		return nil
+	}
+
+	allowedRoles := v.allowedRoles
+	if roles, ok := instance.Tags["vault_allowed_roles"]; ok {
+		allowedRoles = roles
+	}
+
+	username := v.username
+	if username == "" {
+		username = aws.StringValue(instance.MasterUsername)
+	}
+
+	return &vaultConnection{
+		Name:          v.prefix + aws.StringValue(instance.DBInstanceIdentifier),
+		PluginName:    plugin,
+		ConnectionURL: url.String(),
+		AllowedRoles:  splitList(allowedRoles),
+		Username:      username,
+		Verify:        v.verify,
+	}
+}
+
+// passwordWritten returns true if the current password is in the connection, either written by us
+// since the start or matching the password hash stored with the connection
+func (v *vaultSink) passwordWritten(current *vaultConnection) bool {
+	if v.password == "" {
+		return true
+	}
+
+	if written, ok := v.written[current.Name]; ok && written == v.password {
+		return true
+	}
+
+	if current.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(current.PasswordHash), []byte(v.password)) != nil {
+		return false
+	}
+
+	v.written[current.Name] = v.password
+	return true
+}
+
+func (v *vaultSink) path(name string) string {
+	return fmt.Sprintf("%s/config/%s", v.mount, name)
+}
+
+// list returns the names of the connections with our prefix, only those carrying our owner are managed by us
+func (v *vaultSink) list() ([]string, error) {
+	secret, err := v.client.Logical().List(v.mount + "/config")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	if secret == nil || secret.Data == nil {
+		return names, nil
+	}
+
+	keys, _ := secret.Data["keys"].([]interface{})
+	for _, key := range keys {
+		name, ok := key.(string)
+		if ok && strings.HasPrefix(name, v.prefix) {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// read returns the current connection, or nil if it does not exist
+func (v *vaultSink) read(name string) (*vaultConnection, error) {
+	secret, err := v.client.Logical().Read(v.path(name))
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	connection := &vaultConnection{Name: name, AllowedRoles: make([]string, 0)}
+	connection.PluginName, _ = secret.Data["plugin_name"].(string)
+	connection.Verify, _ = secret.Data["verify_connection"].(bool)
+
+	roles, _ := secret.Data["allowed_roles"].([]interface{})
+	for _, role := range roles {
+		if s, ok := role.(string); ok {
+			connection.AllowedRoles = append(connection.AllowedRoles, s)
+		}
+	}
+
+	details, _ := secret.Data["connection_details"].(map[string]interface{})
+	connection.ConnectionURL, _ = details["connection_url"].(string)
+	connection.Username, _ = details["username"].(string)
+	connection.Owner, _ = details[vaultOwnerKey].(string)
+	connection.PasswordHash, _ = details[vaultPasswordHashKey].(string)
+
+	return connection, nil
+}
+
+func (v *vaultSink) write(connection *vaultConnection) error {
+	data := map[string]interface{}{
+		"plugin_name":       connection.PluginName,
+		"connection_url":    connection.ConnectionURL,
+		"allowed_roles":     connection.AllowedRoles,
+		"username":          connection.Username,
+		"verify_connection": connection.Verify,
+		vaultOwnerKey:       v.owner,
+	}
+
+	if v.password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(v.password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("could not hash the password of Vault database connection %s: %s", connection.Name, err)
+		}
+
+		data["password"] = v.password
+		data[vaultPasswordHashKey] = string(hash)
+	}
+
+	if _, err := v.client.Logical().Write(v.path(connection.Name), data); err != nil {
+		return fmt.Errorf("could not write Vault database connection %s: %s", connection.Name, err)
+	}
+
+	v.written[connection.Name] = v.password
+
+	return nil
+}
+
+// track records the outcome of a Vault operation
+func (v *vaultSink) track(operation string, err error, logger *log.Entry) {
+	metrics.BackendOperations.WithLabelValues("vault", operation).Inc()
+
+	if err != nil {
+		metrics.BackendFailures.WithLabelValues("vault", operation).Inc()
+		logger.Error(err)
+		v.failures++
+	} else {
+		v.changes++
+	}
+}
+
+func (a *vaultConnection) identical(b *vaultConnection) bool {
+	return a.PluginName == b.PluginName &&
+		a.ConnectionURL == b.ConnectionURL &&
+		a.Username == b.Username &&
+		a.Verify == b.Verify &&
+		strings.Join(a.AllowedRoles, ",") == strings.Join(b.AllowedRoles, ",")
+}
+
+// splitList splits a comma separated list, ignoring empty items
+func splitList(value string) []string {
+	list := make([]string, 0)
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
@@ -4,19 +4,18 @@ import (
 	"fmt"
 	"os"
 	"reflect"
-	"regexp"
-	"time"
+	"strconv"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	observer "github.com/imkira/go-observer"
 	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/engine"
 	log "github.com/sirupsen/logrus"
 )
 
-var removeUpdatedTimeRegexp = regexp.MustCompile("\n\nLast update: .+")
-
-func (r *RDS) writer(prop observer.Property, state *config.CatalogState) {
-	logger := log.WithField("worker", "writer")
+func (r *RDS) writer(prop observer.Property, t *target) {
+	logger := log.WithFields(log.Fields{"worker": "writer", "target": t.name})
 	logger.Info("Starting RDS Consul Catalog writer")
 
 	stream := prop.Observe()
@@ -28,80 +27,152 @@ func (r *RDS) writer(prop observer.Property, state *config.CatalogState) {
 
 		// wait for changes
 		case <-stream.Changes():
-			state.Lock()
+			stream.Next()
+			r.write(stream.Value().(*config.Snapshot), t, logger)
+		}
+	}
+}
 
-			logger.Debug("Starting Consul Catalog write")
+// write does a single pass of writing the snapshot to the target
+func (r *RDS) write(snapshot *config.Snapshot, t *target, logger *log.Entry) {
+	t.state.Lock()
+	defer t.state.Unlock()
 
-			stream.Next()
-			instances := stream.Value().([]*config.DBInstance)
+	logger = logger.WithField("sync_id", snapshot.SyncID)
+	logger.Debug("Starting Consul Catalog write")
 
-			seen := state.Services.GetSeen()
+	t.recorder.Begin(snapshot.SyncID, snapshot.Trigger, logger)
+	r.resetRejected(t)
 
-			found := &config.SeenCatalog{
-				Services: make([]string, 0),
-				Checks:   make([]string, 0),
-			}
+	owned := make(config.Services)
+	for id, service := range t.state.Services {
+		if service.IsForeign(r.instanceID) {
+			logger.Debugf("Ignoring service %s, it is not managed by %s", id, r.instanceID)
+			continue
+		}
 
-			for _, instance := range instances {
-				r.writeBackendCatalog(instance, logger, state, found)
-			}
+		owned[id] = service
+	}
 
-			for _, service := range r.getDifference(seen.Services, found.Services) {
-				logger.Warnf("Deleting service %s", service)
-				r.backend.DeleteService(service, r.consulNodeName)
-			}
+	e := &engine.Engine{
+		Backend:     t.backend,
+		DefaultNode: r.consulNodeName,
+		Compare: func(existing, desired *config.Service) string {
+			return r.changedField(existing, desired, logger)
+		},
+	}
 
-			for _, check := range r.getDifference(seen.Checks, found.Checks) {
-				logger.Warnf("Deleting check %s", check)
-				r.backend.DeleteCheck(check, r.consulNodeName)
-			}
+	source := &source{r: r, snapshot: snapshot, existing: owned, t: t, logger: logger}
+	e.Sync(source, owned, t.state.Checks, t.recorder)
 
-			logger.Debug("Finished Consul Catalog write")
+	t.recorder.End(source.count)
+	logger.Debug("Finished Consul Catalog write")
 
-			state.Unlock()
-		}
+	if events := t.recorder.Events(); len(events) > 0 {
+		r.sending.Add(1)
+		go func() {
+			defer r.sending.Done()
+			r.notifier.Send(events)
+		}()
 	}
 }
 
-func (r *RDS) writeBackendCatalog(instance *config.DBInstance, logger *log.Entry, state *config.CatalogState, seen *config.SeenCatalog) {
-	logger = logger.WithField("instance", aws.StringValue(instance.DBInstanceIdentifier))
+// getNode returns the catalog node name, address and meta for an instance. An empty address
+// means the node takes the address of the service
+func (r *RDS) getNode(instance *config.DBInstance, nodeAddresses map[string]string) (string, string, map[string]string) {
+	if !r.nodePerInstance && !r.nodePerAZ {
+		return r.consulNodeName, "", nil
+	}
+
+	az := aws.StringValue(instance.AvailabilityZone)
+
+	name := r.consulNodeName + "-" + aws.StringValue(instance.DBInstanceIdentifier)
+	address := ""
 
-	name := r.getServiceName(instance)
-	if name == "" {
-		return
+	// the instances of an AZ share the node, the endpoint of whichever instance was written last
+	// would make its address change on every write
+	if r.nodePerAZ {
+		name = r.consulNodeName + "-" + az
+		address = nodeAddresses[az]
 	}
-	id := name
 
-	if *instance.DBInstanceStatus == "creating" {
-		logger.Warnf("Instance %s id being created, skipping for now", name)
-		return
+	meta := map[string]string{
+		"external-node":      "true",
+		"external-probe":     "false",
+		config.NodeMetaGroup: r.consulNodeName,
+		"availability-zone":  az,
+		"region":             getRegion(instance),
 	}
 
-	if instance.Endpoint == nil {
-		logger.Errorf("Instance %s do not have an endpoint yet, the instance is in state: %s", name, *instance.DBInstanceStatus)
-		return
+	return name, address, meta
+}
+
+// nodeAddresses returns the address of every per-AZ node: the endpoint of the instance with the
+// lowest identifier in the AZ, so it only changes when that instance goes away
+func (r *RDS) nodeAddresses(instances []*config.DBInstance) map[string]string {
+	if !r.nodePerAZ {
+		return nil
 	}
 
+	addresses := make(map[string]string)
+	lowest := make(map[string]string)
+
+	for _, instance := range instances {
+		if instance.Endpoint == nil {
+			continue
+		}
+
+		az := aws.StringValue(instance.AvailabilityZone)
+		id := aws.StringValue(instance.DBInstanceIdentifier)
+
+		if current, ok := lowest[az]; !ok || id < current {
+			lowest[az] = id
+			addresses[az] = aws.StringValue(instance.Endpoint.Address)
+		}
+	}
+
+	return addresses
+}
+
+// getRegion returns the AWS region of an instance, from its ARN
+func getRegion(instance *config.DBInstance) string {
+	instanceArn, err := arn.Parse(aws.StringValue(instance.DBInstanceArn))
+	if err != nil {
+		return ""
+	}
+
+	return instanceArn.Region
+}
+
+// quit sends the pending notifications of the target and exits
+func (r *RDS) quit(t *target) {
+	r.notifier.Send(t.recorder.Events())
+	os.Exit(1)
+}
+
+// buildService returns the service registered under name for an instance
+func (r *RDS) buildService(instance *config.DBInstance, name, lastFailover string, nodeAddresses map[string]string) *config.Service {
+	id := r.getServiceID(instance, name)
+
 	addr := aws.StringValue(instance.Endpoint.Address)
 	port := aws.Int64Value(instance.Endpoint.Port)
 
 	isSlave := instance.ReadReplicaSourceDBInstanceIdentifier != nil
 	isMaster := len(instance.ReadReplicaDBInstanceIdentifiers) > 0
 
-	logger.Debugf("  ID:   %s", id)
-	logger.Debugf("  Name: %s", name)
-	logger.Debugf("  Addr: %s", addr)
-	logger.Debugf("  Port: %d", port)
+	node, nodeAddress, nodeMeta := r.getNode(instance, nodeAddresses)
 
 	tags := make([]string, 0)
 	if isSlave {
 		tags = append(tags, r.consulReplicaTag)
-		id = fmt.Sprintf("%s-%s-%s", id, *instance.DBInstanceIdentifier, r.consulReplicaTag)
+
+		if isRemoteReplica(instance) {
+			tags = append(tags, r.consulRemoteReplicaTag)
+		}
 	}
 
 	if isMaster {
 		tags = append(tags, r.consulMasterTag)
-		id = id + "-" + r.consulMasterTag
 	}
 
 	if !isSlave && !isMaster {
@@ -161,8 +232,10 @@ func (r *RDS) writeBackendCatalog(instance *config.DBInstance, logger *log.Entry
 		ServiceAddress: addr,
 		ServicePort:    int(port),
 		ServiceTags:    tags,
-		CheckID:        fmt.Sprintf("service:%s", id),
-		CheckNode:      r.consulNodeName,
+		CheckID:        config.CheckIDPrefix + id,
+		NodeMeta:       nodeMeta,
+		NodeAddress:    nodeAddress,
+		CheckNode:      node,
 		CheckNotes:     fmt.Sprintf("RDS Instance Status: %s", aws.StringValue(instance.DBInstanceStatus)),
 		CheckStatus:    status,
 		CheckOutput:    fmt.Sprintf("Pending tasks: %s\n\nAddr: %s\n\nmanaged by aws-dynamic-consul-catalog", instance.PendingModifiedValues.GoString(), addr),
@@ -174,148 +247,175 @@ func (r *RDS) writeBackendCatalog(instance *config.DBInstance, logger *log.Entry
 	service.ServiceMeta["DBName"] = aws.StringValue(instance.DBName)
 	service.ServiceMeta["DBInstanceClass"] = aws.StringValue(instance.DBInstanceClass)
 	service.ServiceMeta["DBInstanceIdentifier"] = aws.StringValue(instance.DBInstanceIdentifier)
+	service.ServiceMeta["AvailabilityZone"] = aws.StringValue(instance.AvailabilityZone)
+	service.ServiceMeta["ReplicationRole"] = getRole(instance)
+	if lastFailover != "" {
+		service.ServiceMeta["LastFailover"] = lastFailover
+	}
+	service.ServiceMeta["MultiAZ"] = strconv.FormatBool(aws.BoolValue(instance.MultiAZ))
 
-	if stringInSlice(service.ServiceID, seen.Services) {
-		logger.Errorf("Found duplicate Service ID %s - possible duplicate 'consul_service_name' RDS tag with same Replication Role", service.ServiceID)
-		if r.onDuplicate == "quit" {
-			os.Exit(1)
-		}
-		if r.onDuplicate == "ignore-skip-last" {
-			logger.Errorf("Ignoring current service")
-			return
-		}
+	if source := getReplicaSource(instance); source != nil {
+		service.ServiceMeta["ReadReplicaSourceDBInstanceIdentifier"] = source.Identifier
+		service.ServiceMeta["ReadReplicaSourceRegion"] = source.Region
+		service.ServiceMeta["ReadReplicaSourceAccount"] = source.Account
 	}
-	seen.Services = append(seen.Services, service.ServiceID)
 
-	if stringInSlice(service.CheckID, seen.Checks) {
-		logger.Errorf("Found duplicate Check ID %s - possible duplicate 'consul_service_name' RDS tag with same Replication Role", service.CheckID)
-		if r.onDuplicate == "quit" {
-			os.Exit(1)
-		}
-		if r.onDuplicate == "ignore-skip-last" {
-			logger.Errorf("Ignoring current service")
-			return
-		}
+	if isMaster {
+		service.ServiceMeta["ReadReplicaCount"] = strconv.Itoa(len(instance.ReadReplicaDBInstanceIdentifiers))
 	}
-	seen.Checks = append(seen.Checks, service.CheckID)
 
-	existingService, ok := state.Services[id]
-	if ok {
-		logger.Debugf("Service %s exist in remote catalog, lets compare", id)
+	if az := aws.StringValue(instance.SecondaryAvailabilityZone); az != "" {
+		service.ServiceMeta["SecondaryAvailabilityZone"] = az
+	}
 
-		if r.identicalService(existingService, service, logger) {
-			logger.Debugf("Services are identical, skipping")
-			return
-		}
+	if cluster := aws.StringValue(instance.DBClusterIdentifier); cluster != "" {
+		service.ServiceMeta["DBClusterIdentifier"] = cluster
+	}
+
+	service.ServiceMeta[config.MetaManagedBy] = config.ManagedBy
+	service.ServiceMeta[config.MetaManagedByInstance] = r.instanceID
+	service.ServiceMeta[config.MetaContentHash] = service.ContentHash()
+
+	return service
+}
 
-		logger.Info("Services are not identical, updating catalog")
-	} else {
-		logger.Infof("Service %s doesn't exist in remote catalog, creating", id)
+// getServiceID returns the ID of the service registered under name for an instance
+func (r *RDS) getServiceID(instance *config.DBInstance, name string) string {
+	id := name
+
+	if instance.ReadReplicaSourceDBInstanceIdentifier != nil {
+		id = fmt.Sprintf("%s-%s-%s", id, aws.StringValue(instance.DBInstanceIdentifier), r.consulReplicaTag)
+	}
+
+	if len(instance.ReadReplicaDBInstanceIdentifiers) > 0 {
+		id = id + "-" + r.consulMasterTag
 	}
 
-	service.CheckOutput = service.CheckOutput + fmt.Sprintf("\n\nLast update: %s", time.Now().Format(time.RFC1123Z))
-	r.backend.WriteService(service)
+	return id
 }
 
-func (r *RDS) getServiceName(instance *config.DBInstance) string {
-	// prefer the consul_service_name from instance tags
+func (r *RDS) getServiceNames(instance *config.DBInstance) []string {
+	names := make([]string, 0)
+
+	// prefer the comma separated consul_service_names from instance tags
+	if value, ok := instance.Tags["consul_service_names"]; ok {
+		seen := make(map[string]bool)
+		for _, name := range splitList(value) {
+			name = r.servicePrefix + name + r.serviceSuffix
+
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+
+		if len(names) > 0 {
+			return names
+		}
+	}
+
+	// then the consul_service_name from instance tags
 	if name, ok := instance.Tags["consul_service_name"]; ok {
-		return r.servicePrefix + name + r.serviceSuffix
+		return append(names, r.servicePrefix+name+r.serviceSuffix)
 	}
 
 	// derive from the instance DB name
 	name := aws.StringValue(instance.DBName)
 	if name != "" {
-		return r.servicePrefix + name + r.serviceSuffix
+		return append(names, r.servicePrefix+name+r.serviceSuffix)
 	}
 
 	log.Errorf("Failed to find service name for " + aws.StringValue(instance.DBInstanceArn))
-	return ""
+	return names
 }
 
-func (r *RDS) identicalService(a, b *config.Service, logger *log.Entry) bool {
+// changedField returns the name of the first field that differs between the existing service a and the
+// desired service b, or an empty string if they are identical. The hash of what was read back is compared
+// to the desired hash, the stored hash only records what was last written and is not trusted as the content
+func (r *RDS) changedField(a, b *config.Service, logger *log.Entry) string {
+	// the node address is not part of the content hash, it is only known to backends with nodes
+	if a.NodeAddress != "" && b.NodeAddress != "" && a.NodeAddress != b.NodeAddress {
+		logger.Infof("NodeAddress are not identical (%s vs %s)", a.NodeAddress, b.NodeAddress)
+		return "NodeAddress"
+	}
+
+	if a.ContentHash() == b.ServiceMeta[config.MetaContentHash] {
+		return ""
+	}
+
 	if a.ServiceID != b.ServiceID {
 		logger.Infof("ServiceID are not identical (%s vs %s)", a.ServiceID, b.ServiceID)
-		return false
+		return "ServiceID"
 	}
 
 	if a.ServiceName != b.ServiceName {
 		logger.Infof("ServiceName are not identical (%s vs %s)", a.ServiceName, b.ServiceName)
-		return false
+		return "ServiceName"
+	}
+
+	if a.CheckNode != "" && a.CheckNode != b.CheckNode {
+		logger.Infof("CheckNode are not identical (%s vs %s)", a.CheckNode, b.CheckNode)
+		return "CheckNode"
 	}
 
 	if a.ServiceAddress != b.ServiceAddress {
 		logger.Infof("ServiceAddress are not identical (%s vs %s)", a.ServiceAddress, b.ServiceAddress)
-		return false
+		return "ServiceAddress"
 	}
 
 	if a.ServicePort != b.ServicePort {
 		logger.Infof("ServicePort are not identical (%d vs %d)", a.ServicePort, b.ServicePort)
-		return false
+		return "ServicePort"
 	}
 
 	if a.CheckNotes != b.CheckNotes {
 		logger.Infof("CheckNotes are not identical (%s vs %s)", a.CheckNotes, b.CheckNotes)
-		return false
+		return "CheckNotes"
 	}
 
 	if a.CheckStatus != b.CheckStatus {
 		logger.Infof("CheckStatus are not identical (%s vs %s)", a.CheckStatus, b.CheckStatus)
-		return false
+		return "CheckStatus"
 	}
 
-	if !reflect.DeepEqual(a.ServiceMeta, b.ServiceMeta) {
+	if !reflect.DeepEqual(a.ContentMeta(), b.ContentMeta()) {
 		logger.Infof("ServiceMeta are not identical (%+v vs %+v)", a.ServiceMeta, b.ServiceMeta)
-		return false
+		return "ServiceMeta"
 	}
 
-	if removeUpdatedTimeRegexp.ReplaceAllLiteralString(a.CheckOutput, "") != removeUpdatedTimeRegexp.ReplaceAllLiteralString(b.CheckOutput, "") {
+	if a.CheckOutput != b.CheckOutput {
 		logger.Infof("CheckOutput are not identical (%+v vs %+v)", a.CheckOutput, b.CheckOutput)
-		return false
+		return "CheckOutput"
 	}
 
-	if r.isDifferent(a.ServiceTags, b.ServiceTags) {
+	if !sameTags(a.ServiceTags, b.ServiceTags) {
 		logger.Infof("ServiceTags are not identical (%+v vs %+v)", a.ServiceTags, b.ServiceTags)
-		return false
+		return "ServiceTags"
 	}
 
-	return true
-}
-
-func (r *RDS) getDifference(slice1, slice2 []string) []string {
-	diff := make([]string, 0)
-
-	for _, s1 := range slice1 {
-		found := false
-
-		for _, s2 := range slice2 {
-			if s1 == s2 {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			diff = append(diff, s1)
-		}
+	// nothing we compare changed, but the service was written without the current hash
+	if hash := a.ServiceMeta[config.MetaContentHash]; hash != b.ServiceMeta[config.MetaContentHash] {
+		logger.Infof("ContentHash are not identical (%s vs %s)", hash, b.ServiceMeta[config.MetaContentHash])
+		return "ContentHash"
 	}
 
-	return diff
+	return ""
 }
 
-func (r *RDS) isDifferent(slice1, slice2 []string) bool {
-	if len(r.getDifference(slice1, slice2)) > 0 {
-		return true
+// sameTags returns true if both lists contain the same tags, in any order
+func sameTags(a, b []string) bool {
+	set := make(map[string]bool, len(a))
+	for _, tag := range a {
+		set[tag] = true
 	}
 
-	return len(r.getDifference(slice2, slice1)) > 0
-}
-
-func stringInSlice(a string, list []string) bool {
-	for _, b := range list {
-		if b == a {
-			return true
+	other := make(map[string]bool, len(b))
+	for _, tag := range b {
+		if !set[tag] {
+			return false
 		}
+		other[tag] = true
 	}
-	return false
+
+	return len(set) == len(other)
 }
@@ -0,0 +1,38 @@
+package rds
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config"
+	"github.com/seatgeek/aws-dynamic-consul-catalog/config/configtest"
+)
+
+func TestPerAZNodeAddress(t *testing.T) {
+	r := &RDS{consulNodeName: "rds", nodePerAZ: true}
+
+	orders := testInstance("orders", "available")
+	payments := testInstance("payments", "available")
+	billing := testInstance("billing", "available")
+	billing.AvailabilityZone = aws.String("us-east-1b")
+	creating := testInstance("accounts", "creating")
+	creating.Endpoint = nil
+
+	instances := []*config.DBInstance{payments, orders, billing, creating}
+	addresses := r.nodeAddresses(instances)
+	configtest.Equal(t, addresses, map[string]string{"us-east-1a": "orders.rds.amazonaws.com", "us-east-1b": "billing.rds.amazonaws.com"})
+
+	// every instance of the AZ registers the node with the same address
+	for _, instance := range []*config.DBInstance{orders, payments} {
+		node, address, _ := r.getNode(instance, addresses)
+		if node != "rds-us-east-1a" || address != "orders.rds.amazonaws.com" {
+			t.Errorf("%s is on node %s with address %s", aws.StringValue(instance.DBInstanceIdentifier), node, address)
+		}
+	}
+
+	// other modes leave the address to the service
+	r.nodePerAZ, r.nodePerInstance = false, true
+	if _, address, _ := r.getNode(orders, r.nodeAddresses(instances)); address != "" {
+		t.Errorf("got node address %s in node-per-instance mode", address)
+	}
+}